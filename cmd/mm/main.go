@@ -1,34 +1,58 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/spf13/cobra"
 
 	"micromanager/internal/config"
+	"micromanager/internal/diff"
+	"micromanager/internal/graph"
 	"micromanager/internal/lang"
+	"micromanager/internal/mocks"
+	"micromanager/internal/openapi"
 	"micromanager/internal/runtime"
 	"micromanager/internal/scaffold"
 	mmtest "micromanager/internal/testing"
+	"micromanager/internal/version"
 )
 
 func main() {
 	rootCmd := &cobra.Command{
-		Use:   "mm",
-		Short: "Micromanager CLI",
+		Use:     "mm",
+		Short:   "Micromanager CLI",
+		Version: version.Version,
+		// Commands such as test and update fail to signal results, not misuse.
+		SilenceUsage:  true,
+		SilenceErrors: true,
 	}
 
 	rootCmd.AddCommand(initCommand())
 	rootCmd.AddCommand(newCommand())
 	rootCmd.AddCommand(runCommand())
+	rootCmd.AddCommand(upCommand())
+	rootCmd.AddCommand(graphCommand())
 	rootCmd.AddCommand(updateCommand())
+	rootCmd.AddCommand(addCommand())
+	rootCmd.AddCommand(openapiCommand())
+	rootCmd.AddCommand(mocksCommand())
+	rootCmd.AddCommand(statusCommand())
 	rootCmd.AddCommand(testCommand())
 	rootCmd.AddCommand(packsCommand())
 
-	if err := rootCmd.Execute(); err != nil {
+	// Cancel the command context on Ctrl-C so running services can be cleaned up.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
@@ -73,6 +97,10 @@ func initCommand() *cobra.Command {
 
 func newCommand() *cobra.Command {
 	var empty bool
+	var database, serviceType string
+	var set []string
+	var valuesFile string
+	var dryRun, skipHooks bool
 
 	cmd := &cobra.Command{
 		Use:   "new <service-name>",
@@ -94,13 +122,40 @@ func newCommand() *cobra.Command {
 				return fmt.Errorf("load defaults: %w", err)
 			}
 
-			_, err = scaffold.NewService(root, name, scaffold.NewServiceOptions{
-				Empty:    empty,
-				Defaults: defaults,
-			})
+			setValues, err := parseSetFlags(set)
 			if err != nil {
 				return err
 			}
+			var values map[string]any
+			if valuesFile != "" {
+				if values, err = lang.LoadValues(valuesFile); err != nil {
+					return err
+				}
+			}
+
+			opts := scaffold.NewServiceOptions{
+				Empty:     empty,
+				Database:  database,
+				Type:      serviceType,
+				Values:    values,
+				Set:       setValues,
+				Defaults:  defaults,
+				SkipHooks: skipHooks,
+			}
+			if dryRun {
+				changes, err := scaffold.PlanNewService(root, name, opts)
+				if err != nil {
+					return err
+				}
+				printChanges(changes)
+				return nil
+			}
+
+			report, err := scaffold.NewService(cmd.Context(), root, name, opts)
+			if err != nil {
+				return err
+			}
+			printOrphans(report.Orphans)
 
 			fmt.Printf("Service '%s' created in services/%s\n", name, name)
 			return nil
@@ -108,11 +163,32 @@ func newCommand() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&empty, "empty", false, "generate an external/empty service (Dockerfile + service.toml)")
+	cmd.Flags().StringVar(&database, "database", "", "database the service uses, e.g. postgres")
+	cmd.Flags().StringVar(&serviceType, "type", "", "service type provided by the pack, e.g. http, worker or cron (default: the pack's first type)")
+	cmd.Flags().StringArrayVar(&set, "set", nil, "set a pack variable (key=value, repeatable)")
+	cmd.Flags().StringVar(&valuesFile, "values", "", "TOML file with pack variables")
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes as a diff without writing anything")
+	cmd.Flags().BoolVar(&skipHooks, "skip-hooks", false, "do not run the pack's post-generate hooks")
 	return cmd
 }
 
+// parseSetFlags splits repeated key=value flags.
+func parseSetFlags(flags []string) (map[string]string, error) {
+	values := make(map[string]string, len(flags))
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid --set %q, expected key=value", flag)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
+
 func runCommand() *cobra.Command {
 	var mode string
+	var renderOnly bool
 
 	cmd := &cobra.Command{
 		Use:   "run <path-to-service>",
@@ -121,7 +197,9 @@ func runCommand() *cobra.Command {
 		RunE: func(cmd *cobra.Command, args []string) error {
 			servicePath := args[0]
 
-			if err := runtime.RunService(cmd.Context(), servicePath, mode); err != nil {
+			if err := runtime.RunService(cmd.Context(), servicePath, mode, runtime.RunOptions{
+				RenderOnly: renderOnly,
+			}); err != nil {
 				return err
 			}
 
@@ -130,20 +208,357 @@ func runCommand() *cobra.Command {
 	}
 
 	cmd.Flags().StringVarP(&mode, "mode", "m", runtime.ModeLocal, "environment mode (local, docker, minikube)")
+	cmd.Flags().BoolVar(&renderOnly, "render-only", false, "minikube mode: only write Kubernetes manifests to build/<service>/k8s")
+	return cmd
+}
+
+func upCommand() *cobra.Command {
+	var mode string
+	var readyTimeout time.Duration
+
+	cmd := &cobra.Command{
+		Use:   "up [service...]",
+		Short: "Start services and their dependencies in dependency order",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			return runtime.Up(cmd.Context(), root, args, runtime.UpOptions{
+				Mode:         mode,
+				ReadyTimeout: readyTimeout,
+			})
+		},
+	}
+
+	cmd.Flags().StringVarP(&mode, "mode", "m", runtime.ModeLocal, "environment mode (local, docker, minikube)")
+	cmd.Flags().DurationVar(&readyTimeout, "ready-timeout", runtime.DefaultReadyTimeout, "how long to wait for each service to accept connections")
+	return cmd
+}
+
+func graphCommand() *cobra.Command {
+	var format string
+	var dependentsOf string
+
+	cmd := &cobra.Command{
+		Use:   "graph",
+		Short: "Export the service dependency graph",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			g, err := graph.Load(root)
+			if err != nil {
+				return err
+			}
+
+			if dependentsOf != "" {
+				if _, ok := g.Node(dependentsOf); !ok {
+					return fmt.Errorf("service %q not found", dependentsOf)
+				}
+				for _, name := range g.Dependents(dependentsOf) {
+					fmt.Println(name)
+				}
+				return nil
+			}
+
+			return graph.Write(os.Stdout, g, format)
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", graph.FormatDOT, "output format (dot, mermaid, json)")
+	cmd.Flags().StringVar(&dependentsOf, "dependents", "", "list the services that depend on this service, directly or transitively")
 	return cmd
 }
 
 func updateCommand() *cobra.Command {
+	var dryRun, skipHooks bool
+
+	cmd := &cobra.Command{
+		Use:   "update [service...]",
+		Short: "Regenerate services from their packs and merge the changes",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			defaults, err := config.LoadDefaults(root)
+			if err != nil {
+				return fmt.Errorf("load defaults: %w", err)
+			}
+
+			report, err := scaffold.UpdateServices(cmd.Context(), root, args, scaffold.UpdateOptions{
+				Defaults:  defaults,
+				DryRun:    dryRun,
+				SkipHooks: skipHooks,
+			})
+			if dryRun && err == nil {
+				printChanges(report.Changes)
+				return nil
+			}
+			printUpdateReport(report)
+			if err != nil {
+				return err
+			}
+			if n := report.Conflicts(); n > 0 {
+				return fmt.Errorf("%d file(s) have conflicts, resolve the markers and commit", n)
+			}
+			return nil
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "print the changes as a diff without writing anything")
+	cmd.Flags().BoolVar(&skipHooks, "skip-hooks", false, "do not run the pack's post-generate hooks")
+	return cmd
+}
+
+func addCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add",
+		Short: "Add code to an existing service",
+	}
+
+	endpointCmd := &cobra.Command{
+		Use:   "endpoint <service> <method> <path> <name>",
+		Short: "Add an endpoint to a Go service",
+		Long: `Endpoint edits the Go code of a service to add an operation: <name>Request and
+<name>Response types and a method in api/, a route in NewRouter, a client method
+and a core stub returning "not implemented". Path parameters such as :id become
+fields of the request. When the service has an API definition, the operation is
+recorded there too. Nothing is written if any part of the endpoint exists.`,
+		Example: "  mm add endpoint orders POST /orders CreateOrder\n  mm add endpoint orders GET /orders/:id GetOrder",
+		Args:    cobra.ExactArgs(4),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			defaults, err := config.LoadDefaults(root)
+			if err != nil {
+				return fmt.Errorf("load defaults: %w", err)
+			}
+
+			report, err := scaffold.AddEndpoint(root, args[0], scaffold.AddEndpointOptions{
+				Method:   args[1],
+				Path:     args[2],
+				Name:     args[3],
+				Defaults: defaults,
+			})
+			if err != nil {
+				return err
+			}
+			for _, f := range report.Files {
+				fmt.Printf("%-9s %s\n", "updated", f)
+			}
+			if report.API != "" {
+				fmt.Printf("%-9s %s\n", "updated", report.API)
+			}
+			fmt.Printf("Endpoint %s %s added to %s\n", strings.ToUpper(args[1]), args[2], args[0])
+			return nil
+		},
+	}
+
+	cmd.AddCommand(endpointCmd)
+	return cmd
+}
+
+func openapiCommand() *cobra.Command {
+	var format, output, apiVersion string
+
+	cmd := &cobra.Command{
+		Use:   "openapi <service>",
+		Short: "Export the OpenAPI 3.1 document of a Go service",
+		Long: `Openapi reads the api and server packages of a service and writes an OpenAPI 3.1
+document. Every route of NewRouter whose handler calls an api.Service method
+becomes an operation. Request fields tagged uri are path parameters, fields
+tagged form are query parameters of GET and DELETE routes, and the request is
+the JSON body of every other method. Schemas follow the json tags, and the
+validator rules of binding tags such as required, min, max, oneof and email.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			doc, err := openapi.Build(root, args[0], openapi.Options{Version: apiVersion})
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				return openapi.Write(os.Stdout, doc, format)
+			}
+
+			f, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			if err := openapi.Write(f, doc, format); err != nil {
+				f.Close()
+				return err
+			}
+			return f.Close()
+		},
+	}
+
+	cmd.Flags().StringVarP(&format, "format", "f", openapi.FormatYAML, "output format (yaml, json)")
+	cmd.Flags().StringVarP(&output, "output", "o", "", "write the document to a file instead of stdout")
+	cmd.Flags().StringVar(&apiVersion, "api-version", "1.0.0", "info.version of the document")
+	return cmd
+}
+
+func mocksCommand() *cobra.Command {
 	return &cobra.Command{
-		Use:   "update",
-		Short: "Rescan services and apply structural updates",
+		Use:   "mocks [service...]",
+		Short: "Generate programmable fakes of Go service APIs",
+		Long: `Mocks writes services/<service>/mock/service.go, a fake of the service's
+api.Service interface for the unit tests of the services calling it. The fake
+records every call and answers with a function set for the method or with
+results scripted through Return<Method>. Without arguments, every service with
+an api package gets a mock. mm update and mm add endpoint regenerate existing
+mocks when the API changes.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			results, err := mocks.Generate(root, args)
+			if err != nil {
+				return err
+			}
+			for _, r := range results {
+				fmt.Printf("%-9s %s\n", r.Status, r.Path)
+			}
+			if len(results) == 0 {
+				fmt.Println("No services with an api package")
+			}
+			return nil
+		},
+	}
+}
+
+// printChanges prints a unified diff of planned changes followed by a summary.
+func printChanges(changes []lang.Change) {
+	byKind := make(map[lang.ChangeKind][]string)
+	for _, c := range changes {
+		from, to := "a/"+c.Path, "b/"+c.Path
+		switch c.Kind {
+		case lang.ChangeCreated:
+			from = "/dev/null"
+		case lang.ChangeDeleted:
+			to = "/dev/null"
+		}
+		fmt.Print(diff.Unified(from, to, c.Old, c.New))
+		byKind[c.Kind] = append(byKind[c.Kind], c.Path)
+	}
+
+	if len(changes) > 0 {
+		fmt.Println()
+	}
+	for _, kind := range []lang.ChangeKind{lang.ChangeCreated, lang.ChangeModified, lang.ChangeDeleted} {
+		for _, p := range byKind[kind] {
+			fmt.Printf("%-9s %s\n", kind, p)
+		}
+	}
+	fmt.Printf("%d created, %d modified, %d deleted (dry run, nothing written)\n",
+		len(byKind[lang.ChangeCreated]), len(byKind[lang.ChangeModified]), len(byKind[lang.ChangeDeleted]))
+}
+
+func printUpdateReport(report scaffold.UpdateReport) {
+	counts := make(map[scaffold.UpdateStatus]int)
+	for _, f := range report.Files {
+		counts[f.Status]++
+		if f.Status == scaffold.StatusUnchanged {
+			continue
+		}
+		line := fmt.Sprintf("%-9s %s", f.Status, f.Path)
+		if f.Conflicts > 0 {
+			line += fmt.Sprintf(" (%d conflict(s))", f.Conflicts)
+		}
+		if f.Note != "" {
+			line += fmt.Sprintf(" (%s)", f.Note)
+		}
+		fmt.Println(line)
+	}
+	fmt.Printf("%d created, %d updated, %d merged, %d conflicted, %d deleted, %d skipped, %d unchanged\n",
+		counts[scaffold.StatusCreated], counts[scaffold.StatusUpdated], counts[scaffold.StatusMerged],
+		counts[scaffold.StatusConflict], counts[scaffold.StatusDeleted], counts[scaffold.StatusSkipped],
+		counts[scaffold.StatusUnchanged])
+	printOrphans(report.Orphans())
+}
+
+// printOrphans warns about keep-blocks that regeneration did not carry over.
+func printOrphans(orphans []lang.OrphanBlock) {
+	for _, o := range orphans {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", o)
+	}
+}
+
+func statusCommand() *cobra.Command {
+	var drift bool
+
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show generated files recorded in the manifest",
+		Args:  cobra.NoArgs,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return fmt.Errorf("not implemented yet")
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+
+			if !drift {
+				manifest, err := lang.LoadManifest(root)
+				if err != nil {
+					return err
+				}
+				if len(manifest.Files) == 0 {
+					fmt.Println("No generated files recorded in .mm/manifest.toml")
+					return nil
+				}
+				for _, e := range manifest.Files {
+					fmt.Printf("%s\t%s@%s\t%s\n", e.Path, e.Pack, e.PackVersion, e.Template)
+				}
+				return nil
+			}
+
+			defaults, err := config.LoadDefaults(root)
+			if err != nil {
+				return fmt.Errorf("load defaults: %w", err)
+			}
+			drifts, err := scaffold.CheckDrift(root, scaffold.UpdateOptions{Defaults: defaults})
+			if err != nil {
+				return err
+			}
+			if len(drifts) == 0 {
+				fmt.Println("No drift detected")
+				return nil
+			}
+			for _, d := range drifts {
+				line := fmt.Sprintf("%-8s %s", d.Kind, d.Path)
+				if d.Note != "" {
+					line += fmt.Sprintf(" (%s)", d.Note)
+				}
+				fmt.Println(line)
+			}
+			return fmt.Errorf("drift detected in %d file(s)", len(drifts))
 		},
 	}
+
+	cmd.Flags().BoolVar(&drift, "drift", false, "report files that were hand-edited, deleted or are stale relative to the pack")
+	return cmd
 }
 
 func testCommand() *cobra.Command {
+	var parallel int
+
 	cmd := &cobra.Command{
 		Use:   "test [path]",
 		Short: "Run tests",
@@ -159,9 +574,19 @@ func testCommand() *cobra.Command {
 				return err
 			}
 
-			return mmtest.Run(cmd.Context(), root, target)
+			defaults, err := config.LoadDefaults(root)
+			if err != nil {
+				return fmt.Errorf("load defaults: %w", err)
+			}
+
+			return mmtest.Run(cmd.Context(), root, target, mmtest.Options{
+				Concurrency: parallel,
+				Defaults:    defaults,
+			})
 		},
 	}
+
+	cmd.Flags().IntVarP(&parallel, "parallel", "j", 0, "number of services tested at once (default: number of CPUs)")
 	return cmd
 }
 
@@ -173,55 +598,234 @@ func packsCommand() *cobra.Command {
 
 	listCmd := &cobra.Command{
 		Use:   "list",
-		Short: "List available language packs",
+		Short: "List available language packs and where they come from",
 		RunE: func(cmd *cobra.Command, args []string) error {
 			root, err := os.Getwd()
 			if err != nil {
 				return err
 			}
-			packs, err := lang.LoadAll(root)
+			found, err := lang.Discover(root)
 			if err != nil {
 				return err
 			}
-			if len(packs) == 0 {
-				fmt.Println("No packs found in .mm/packs")
-				return nil
+			seen := make(map[string]bool)
+			listed := 0
+			for _, f := range found {
+				if f.Err != nil {
+					continue
+				}
+				printPack(f.Pack, seen[f.Pack.Meta.ID])
+				seen[f.Pack.Meta.ID] = true
+				listed++
 			}
-			for _, p := range packs {
-				fmt.Printf("%s\t%s\t(lang=%s, v=%s)\n", p.Meta.ID, p.Meta.Name, p.Meta.Lang, p.Meta.Version)
+			if listed == 0 {
+				fmt.Println("No packs found")
 			}
 			return nil
 		},
 	}
 
 	validateCmd := &cobra.Command{
-		Use:   "validate",
-		Short: "Validate all language packs",
+		Use:   "validate [id...]",
+		Short: "Validate language packs and their templates",
+		Long: `Validate checks every pack manifest, parses every template, renders the pack
+with sample data and syntax-checks the Go, TOML, YAML and JSON it produces.
+It exits non-zero when any pack is invalid. Required tools that are not on
+PATH or whose --version (or version) does not satisfy the pack's constraint
+are reported as warnings.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
 			root, err := os.Getwd()
 			if err != nil {
 				return err
 			}
-			packs, err := lang.LoadAll(root)
+			found, err := lang.Discover(root)
 			if err != nil {
 				return err
 			}
-			if len(packs) == 0 {
-				fmt.Println("No packs found in .mm/packs")
+			if len(args) > 0 {
+				wanted := make(map[string]bool)
+				for _, id := range args {
+					wanted[id] = true
+				}
+				var selected []lang.Found
+				for _, f := range found {
+					if wanted[f.Name] {
+						selected = append(selected, f)
+						delete(wanted, f.Name)
+					}
+				}
+				if len(wanted) > 0 {
+					missing := make([]string, 0, len(wanted))
+					for id := range wanted {
+						missing = append(missing, id)
+					}
+					sort.Strings(missing)
+					if len(missing) == 1 {
+						return fmt.Errorf("pack %s not found", missing[0])
+					}
+					return fmt.Errorf("packs not found: %s", strings.Join(missing, ", "))
+				}
+				found = selected
+			}
+			if len(found) == 0 {
+				fmt.Println("No packs found")
 				return nil
 			}
-			for _, p := range packs {
-				if err := lang.Validate(p); err != nil {
-					fmt.Printf("%s: INVALID (%v)\n", p.Meta.ID, err)
+
+			invalid := 0
+			for _, f := range found {
+				var problems []string
+				if f.Err != nil {
+					problems = strings.Split(f.Err.Error(), "\n")
 				} else {
-					fmt.Printf("%s: OK\n", p.Meta.ID)
+					checked := lang.CheckTemplates(f.Pack)
+					lang.SortProblems(checked)
+					for _, pr := range checked {
+						problems = append(problems, pr.String())
+					}
+				}
+				if len(problems) > 0 {
+					invalid++
+					fmt.Printf("%s [%s]: INVALID\n", f.Name, f.Pack.Source)
+					for _, line := range problems {
+						fmt.Printf("  %s\n", line)
+					}
+					continue
 				}
+				fmt.Printf("%s [%s]: OK\n", f.Name, f.Pack.Source)
+				for _, tool := range lang.MissingTools(f.Pack) {
+					fmt.Printf("  warning: required tool %s\n", tool)
+				}
+			}
+			if invalid > 0 {
+				return fmt.Errorf("%d of %d pack(s) invalid", invalid, len(found))
 			}
 			return nil
 		},
 	}
 
+	installCmd := &cobra.Command{
+		Use:   "install <dir|tarball|git-url>",
+		Short: "Install a pack into .mm/packs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			p, err := lang.InstallPack(root, args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("Installed %s %s into %s\n", p.Meta.ID, p.Meta.Version, p.BaseDir)
+			return nil
+		},
+	}
+
+	removeCmd := &cobra.Command{
+		Use:   "remove <id>",
+		Short: "Remove a pack from .mm/packs",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			id := args[0]
+			if err := lang.RemovePack(root, id); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s\n", id)
+			services, err := lang.ServicesUsingPack(root, id)
+			if err != nil {
+				return err
+			}
+			if len(services) > 0 {
+				fmt.Printf("Services generated with %s now use the next pack for their language: %s\n", id, strings.Join(services, ", "))
+			}
+			return nil
+		},
+	}
+
+	var upgradeFrom string
+	upgradeCmd := &cobra.Command{
+		Use:   "upgrade <id>",
+		Short: "Reinstall a pack from its recorded source and show what changed",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			root, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			res, err := lang.UpgradePack(root, args[0], upgradeFrom)
+			if err != nil {
+				return err
+			}
+			if res.UpToDate {
+				fmt.Printf("%s %s is up to date\n", res.ID, res.OldVersion)
+				return nil
+			}
+			fmt.Printf("%s: %s -> %s\n", res.ID, res.OldVersion, res.NewVersion)
+			for _, f := range res.Files {
+				fmt.Printf("  %-9s %s\n", f.Kind, f.Path)
+			}
+			fmt.Println("Run mm update to regenerate services with the new pack")
+			return nil
+		},
+	}
+	upgradeCmd.Flags().StringVar(&upgradeFrom, "from", "", "install from this source instead of the recorded one")
+
 	cmd.AddCommand(listCmd)
 	cmd.AddCommand(validateCmd)
+	cmd.AddCommand(installCmd)
+	cmd.AddCommand(removeCmd)
+	cmd.AddCommand(upgradeCmd)
 	return cmd
 }
+
+func printPack(p lang.Pack, overridden bool) {
+	m := p.Meta
+	source := p.Source
+	if p.BaseDir != "" {
+		source += " " + p.BaseDir
+	}
+	if overridden {
+		source += ", overridden"
+	}
+	fmt.Printf("%s\t%s\t(lang=%s, v=%s)\t[%s]\n", m.ID, m.Name, m.Lang, m.Version, source)
+	if m.Description != "" {
+		fmt.Printf("  %s\n", m.Description)
+	}
+	if m.Extends != "" {
+		fmt.Printf("  extends: %s\n", m.Extends)
+	}
+	if m.MMVersion != "" {
+		fmt.Printf("  mm: %s\n", m.MMVersion)
+	}
+	for i, t := range m.ServiceTypes {
+		line := "  service type: " + t.Name
+		if i == 0 {
+			line += " (default)"
+		}
+		if t.Description != "" {
+			line += " - " + t.Description
+		}
+		fmt.Println(line)
+	}
+	for _, r := range m.Requires {
+		fmt.Printf("  requires: %s %s\n", r.Tool, r.Version)
+	}
+	for _, v := range m.Variables {
+		line := fmt.Sprintf("  variable: %s (%s)", v.Name, v.Type)
+		if v.Default != nil {
+			line += fmt.Sprintf(" default=%v", v.Default)
+		}
+		if v.Prompt != "" {
+			line += " - " + v.Prompt
+		}
+		fmt.Println(line)
+	}
+	for _, h := range m.Hooks.PostGenerate {
+		fmt.Printf("  post-generate hook: %s\n", strings.Join(h.Command, " "))
+	}
+}
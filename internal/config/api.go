@@ -0,0 +1,342 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// APIFile is the per-service API definition used when service.toml has no
+// [api] section.
+const APIFile = "api.toml"
+
+// APIConfig declares the operations of a service and the types they use.
+type APIConfig struct {
+	Operations []Operation `toml:"operations"`
+	Types      []TypeDef   `toml:"types,omitempty"`
+}
+
+// Operation is a single endpoint. Path is relative to the service route
+// prefix; ":name" or "{name}" segments are bound to the request field with
+// that JSON name. Request and Response name declared types and may be empty.
+type Operation struct {
+	Name     string `toml:"name"`
+	Method   string `toml:"method"`
+	Path     string `toml:"path"`
+	Request  string `toml:"request,omitempty"`
+	Response string `toml:"response,omitempty"`
+	Doc      string `toml:"doc,omitempty"`
+}
+
+// TypeDef declares a struct type of the API.
+type TypeDef struct {
+	Name   string  `toml:"name"`
+	Doc    string  `toml:"doc,omitempty"`
+	Fields []Field `toml:"fields,inline"`
+}
+
+// Field is a struct field. Type is a Go type expression over builtin and
+// declared types, e.g. "[]Item" or "*User". JSON defaults to the snake_case
+// field name and Binding holds validator rules such as "required,email".
+type Field struct {
+	Name    string `toml:"name"`
+	Type    string `toml:"type"`
+	JSON    string `toml:"json,omitempty"`
+	Binding string `toml:"binding,omitempty"`
+}
+
+// HTTP methods an operation may use.
+var apiMethods = []string{"GET", "POST", "PUT", "PATCH", "DELETE"}
+
+// scalarTypes can be bound from path and query parameters.
+var scalarTypes = map[string]bool{
+	"string": true, "bool": true,
+	"int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true,
+	"float32": true, "float64": true,
+}
+
+var builtinTypes = map[string]bool{"any": true, "byte": true, "rune": true}
+
+// LoadAPI returns the API definition of a service: the [api] section of its
+// service.toml or, without one, services/<name>/api.toml. It returns nil when
+// the service declares neither.
+func LoadAPI(root, serviceName string, cfg ServiceConfig) (*APIConfig, error) {
+	if cfg.API != nil {
+		if err := cfg.API.Validate(); err != nil {
+			return nil, fmt.Errorf("service.toml [api]: %w", err)
+		}
+		return cfg.API, nil
+	}
+	data, err := os.ReadFile(filepath.Join(root, "services", serviceName, APIFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	api, err := ParseAPI(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", APIFile, err)
+	}
+	return api, nil
+}
+
+// ParseAPI decodes and validates an api.toml.
+func ParseAPI(data []byte) (*APIConfig, error) {
+	var api APIConfig
+	if err := toml.Unmarshal(data, &api); err != nil {
+		return nil, err
+	}
+	if err := api.Validate(); err != nil {
+		return nil, err
+	}
+	return &api, nil
+}
+
+// MarshalAPI encodes an API in the style of the api.toml files packs ship:
+// one [[operations]] or [[types]] table per entry, separated by blank
+// lines, with the fields of a type as an array of inline tables, one per
+// line. Entries can be appended to such a file as they are.
+func MarshalAPI(api APIConfig) []byte {
+	var buf bytes.Buffer
+	entry := func(header string, pairs [][2]string) {
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		buf.WriteString(header + "\n")
+		for _, kv := range pairs {
+			if kv[1] != "" {
+				fmt.Fprintf(&buf, "%s = %s\n", kv[0], strconv.Quote(kv[1]))
+			}
+		}
+	}
+	for _, op := range api.Operations {
+		entry("[[operations]]", [][2]string{
+			{"name", op.Name}, {"method", op.Method}, {"path", op.Path},
+			{"request", op.Request}, {"response", op.Response}, {"doc", op.Doc},
+		})
+	}
+	for _, t := range api.Types {
+		entry("[[types]]", [][2]string{{"name", t.Name}, {"doc", t.Doc}})
+		if len(t.Fields) == 0 {
+			buf.WriteString("fields = []\n")
+			continue
+		}
+		buf.WriteString("fields = [\n")
+		for _, f := range t.Fields {
+			pairs := [][2]string{{"name", f.Name}, {"type", f.Type}}
+			if f.JSON != "" {
+				pairs = append(pairs, [2]string{"json", f.JSON})
+			}
+			if f.Binding != "" {
+				pairs = append(pairs, [2]string{"binding", f.Binding})
+			}
+			fmt.Fprintf(&buf, "  %s,\n", inlineTable(pairs))
+		}
+		buf.WriteString("]\n")
+	}
+	return buf.Bytes()
+}
+
+// Type returns the declared type with the given name.
+func (a APIConfig) Type(name string) (TypeDef, bool) {
+	for _, t := range a.Types {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return TypeDef{}, false
+}
+
+// Validate checks names, methods, paths and type references.
+func (a APIConfig) Validate() error {
+	var errs []error
+	types := make(map[string]bool)
+	for _, t := range a.Types {
+		if !token.IsIdentifier(t.Name) || !token.IsExported(t.Name) {
+			errs = append(errs, fmt.Errorf("type %q: name must be an exported identifier", t.Name))
+		}
+		if types[t.Name] {
+			errs = append(errs, fmt.Errorf("type %s: declared twice", t.Name))
+		}
+		types[t.Name] = true
+	}
+	for _, t := range a.Types {
+		fields := make(map[string]bool)
+		for _, f := range t.Fields {
+			if !token.IsIdentifier(f.Name) || !token.IsExported(f.Name) {
+				errs = append(errs, fmt.Errorf("type %s: field %q must be an exported identifier", t.Name, f.Name))
+			}
+			if fields[f.Name] {
+				errs = append(errs, fmt.Errorf("type %s: field %s declared twice", t.Name, f.Name))
+			}
+			fields[f.Name] = true
+			if err := checkTypeExpr(f.Type, types); err != nil {
+				errs = append(errs, fmt.Errorf("type %s: field %s: %w", t.Name, f.Name, err))
+			}
+		}
+	}
+
+	names := make(map[string]bool)
+	routes := make(map[string]bool)
+	for _, op := range a.Operations {
+		if !token.IsIdentifier(op.Name) || !token.IsExported(op.Name) {
+			errs = append(errs, fmt.Errorf("operation %q: name must be an exported identifier", op.Name))
+		}
+		if names[op.Name] {
+			errs = append(errs, fmt.Errorf("operation %s: declared twice", op.Name))
+		}
+		names[op.Name] = true
+
+		method := strings.ToUpper(op.Method)
+		known := false
+		for _, m := range apiMethods {
+			known = known || m == method
+		}
+		if !known {
+			errs = append(errs, fmt.Errorf("operation %s: method must be one of %s", op.Name, strings.Join(apiMethods, ", ")))
+		}
+		if !strings.HasPrefix(op.Path, "/") {
+			errs = append(errs, fmt.Errorf("operation %s: path must start with /", op.Name))
+		}
+		route := method + " " + op.RoutePath()
+		if routes[route] {
+			errs = append(errs, fmt.Errorf("operation %s: route %s declared twice", op.Name, route))
+		}
+		routes[route] = true
+
+		for _, ref := range []string{op.Request, op.Response} {
+			if ref != "" && !types[ref] {
+				errs = append(errs, fmt.Errorf("operation %s: unknown type %s", op.Name, ref))
+			}
+		}
+		req, _ := a.Type(op.Request)
+		for _, param := range op.PathParams() {
+			f, ok := req.Field(param)
+			if !ok {
+				errs = append(errs, fmt.Errorf("operation %s: path parameter %s is not a field of the request", op.Name, param))
+			} else if !scalarTypes[f.Type] {
+				errs = append(errs, fmt.Errorf("operation %s: path parameter %s must have a scalar type", op.Name, param))
+			}
+		}
+		if !op.HasBody() {
+			for _, f := range req.Fields {
+				if !scalarTypes[f.Type] {
+					errs = append(errs, fmt.Errorf("operation %s: %s requests are sent as query parameters, field %s must have a scalar type", op.Name, method, f.Name))
+				}
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// RoutePath returns Path with "{name}" segments written as ":name".
+func (o Operation) RoutePath() string {
+	segments := strings.Split(o.Path, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			segments[i] = ":" + seg[1:len(seg)-1]
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// PathParams returns the names of the path parameters in order.
+func (o Operation) PathParams() []string {
+	var params []string
+	for _, seg := range strings.Split(o.RoutePath(), "/") {
+		if name, ok := strings.CutPrefix(seg, ":"); ok {
+			params = append(params, name)
+		}
+	}
+	return params
+}
+
+// HasBody reports whether the request is sent as a JSON body rather than as
+// query parameters.
+func (o Operation) HasBody() bool {
+	switch strings.ToUpper(o.Method) {
+	case "GET", "DELETE":
+		return false
+	}
+	return o.Request != ""
+}
+
+// Field returns the field with the given JSON name.
+func (t TypeDef) Field(jsonName string) (Field, bool) {
+	for _, f := range t.Fields {
+		if f.JSONName() == jsonName {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// JSONName returns the JSON key of the field.
+func (f Field) JSONName() string {
+	if f.JSON != "" {
+		return f.JSON
+	}
+	return snakeCase(f.Name)
+}
+
+// checkTypeExpr verifies that expr is a Go type using only builtin and
+// declared types.
+func checkTypeExpr(expr string, declared map[string]bool) error {
+	if strings.TrimSpace(expr) == "" {
+		return errors.New("type is required")
+	}
+	node, err := parser.ParseExpr(expr)
+	if err != nil {
+		return fmt.Errorf("invalid type %q", expr)
+	}
+	var bad error
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if !scalarTypes[n.Name] && !builtinTypes[n.Name] && !declared[n.Name] {
+				bad = fmt.Errorf("unknown type %s", n.Name)
+			}
+		case *ast.ArrayType, *ast.StarExpr, *ast.MapType:
+		default:
+			if n != nil {
+				bad = fmt.Errorf("unsupported type %q", expr)
+				return false
+			}
+		}
+		return bad == nil
+	})
+	return bad
+}
+
+// snakeCase converts a Go identifier such as ItemID to item_id.
+func snakeCase(s string) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i, r := range runes {
+		upper := r >= 'A' && r <= 'Z'
+		if upper && i > 0 {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && runes[i+1] >= 'a' && runes[i+1] <= 'z'
+			if (prev >= 'a' && prev <= 'z') || (prev >= '0' && prev <= '9') || (prev >= 'A' && prev <= 'Z' && nextLower) {
+				b.WriteByte('_')
+			}
+		}
+		if upper {
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,86 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMarshalAPI(t *testing.T) {
+	api := APIConfig{
+		Operations: []Operation{
+			{Name: "GetOrder", Method: "GET", Path: "/orders/:id", Request: "GetOrderRequest", Response: "Order"},
+			{Name: "Ping", Method: "GET", Path: "/ping", Doc: `Ping answers "pong".`},
+		},
+		Types: []TypeDef{
+			{Name: "GetOrderRequest", Fields: []Field{{Name: "ID", Type: "string", JSON: "id", Binding: "required,uuid"}}},
+			{Name: "Order", Doc: "Order is an order.", Fields: []Field{{Name: "ID", Type: "string"}, {Name: "Items", Type: "[]string"}}},
+			{Name: "Empty"},
+		},
+	}
+	want := `[[operations]]
+name = "GetOrder"
+method = "GET"
+path = "/orders/:id"
+request = "GetOrderRequest"
+response = "Order"
+
+[[operations]]
+name = "Ping"
+method = "GET"
+path = "/ping"
+doc = "Ping answers \"pong\"."
+
+[[types]]
+name = "GetOrderRequest"
+fields = [
+  { name = "ID", type = "string", json = "id", binding = "required,uuid" },
+]
+
+[[types]]
+name = "Order"
+doc = "Order is an order."
+fields = [
+  { name = "ID", type = "string" },
+  { name = "Items", type = "[]string" },
+]
+
+[[types]]
+name = "Empty"
+fields = []
+`
+	got := MarshalAPI(api)
+	if string(got) != want {
+		t.Errorf("MarshalAPI:\n%s\nwant:\n%s", got, want)
+	}
+	parsed, err := ParseAPI(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.Types[2].Fields = []Field{}
+	if !reflect.DeepEqual(*parsed, api) {
+		t.Errorf("round trip:\n got %+v\nwant %+v", *parsed, api)
+	}
+}
+
+func TestMarshalServiceConfigEnvironment(t *testing.T) {
+	cfg := ServiceConfig{
+		General: GeneralConfig{Lang: "go"},
+		Environment: map[string]map[string]string{
+			"PORT":          {"docker": "8000", "local": "8000"},
+			"GREETING_TAIL": {"local": "from local env"},
+		},
+	}
+	data, err := MarshalServiceConfig(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `
+[environment]
+GREETING_TAIL = { local = "from local env" }
+PORT          = { local = "8000", docker = "8000" }
+`
+	if got := string(data); !strings.HasSuffix(got, want) {
+		t.Errorf("MarshalServiceConfig:\n%s\nwant it to end with:\n%s", got, want)
+	}
+}
@@ -1,11 +1,15 @@
 package config
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 
 	toml "github.com/pelletier/go-toml/v2"
 )
@@ -19,6 +23,8 @@ type Defaults struct {
 type ServiceConfig struct {
 	General      GeneralConfig                `toml:"general"`
 	Dependencies DependenciesConfig           `toml:"dependencies"`
+	Vars         map[string]any               `toml:"vars,omitempty"` // pack variables set at creation
+	API          *APIConfig                   `toml:"api,omitempty"`  // overrides api.toml
 	Environment  map[string]map[string]string `toml:"environment"`
 }
 
@@ -26,6 +32,9 @@ type ServiceConfig struct {
 type GeneralConfig struct {
 	Lang     string `toml:"lang"`
 	Database string `toml:"database,omitempty"`
+	// Type is the pack's service type, e.g. "http" or "worker". Empty
+	// means the pack's default type.
+	Type     string `toml:"type,omitempty"`
 	External bool   `toml:"external,omitempty"`
 }
 
@@ -81,6 +90,58 @@ func SaveDefaults(root string, cfg Defaults) error {
 	return os.WriteFile(path, data, 0o644)
 }
 
+// modeOrder fixes the column order of environment values in service.toml.
+var modeOrder = []string{"local", "docker", "minikube"}
+
+// AddEnvironment adds variables and mode values that are not yet declared.
+// Values already present in the config are kept as is. It reports whether
+// anything was added.
+func (s *ServiceConfig) AddEnvironment(env map[string]map[string]string) bool {
+	if len(env) == 0 {
+		return false
+	}
+	added := false
+	if s.Environment == nil {
+		s.Environment = make(map[string]map[string]string)
+	}
+	for name, values := range env {
+		current, ok := s.Environment[name]
+		if !ok {
+			current = make(map[string]string)
+			s.Environment[name] = current
+		}
+		for mode, value := range values {
+			if _, ok := current[mode]; !ok {
+				current[mode] = value
+				added = true
+			}
+		}
+	}
+	return added
+}
+
+// ListServices returns the names of services under services/ that have a service.toml.
+func ListServices(root string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, "services"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(root, "services", e.Name(), "service.toml")); err != nil {
+			continue
+		}
+		names = append(names, e.Name())
+	}
+	return names, nil
+}
+
 // LoadServiceConfig reads services/<name>/service.toml.
 func LoadServiceConfig(root, serviceName string) (ServiceConfig, error) {
 	path := filepath.Join(root, "services", serviceName, "service.toml")
@@ -88,10 +149,38 @@ func LoadServiceConfig(root, serviceName string) (ServiceConfig, error) {
 	if err != nil {
 		return ServiceConfig{}, err
 	}
-	var cfg ServiceConfig
-	if err := toml.Unmarshal(data, &cfg); err != nil {
+	return ParseServiceConfig(data)
+}
+
+// ParseServiceConfig decodes service.toml content. Environment values may be
+// written as any TOML scalar and are converted to strings.
+func ParseServiceConfig(data []byte) (ServiceConfig, error) {
+	var raw struct {
+		General      GeneralConfig             `toml:"general"`
+		Dependencies DependenciesConfig        `toml:"dependencies"`
+		Vars         map[string]any            `toml:"vars"`
+		API          *APIConfig                `toml:"api"`
+		Environment  map[string]map[string]any `toml:"environment"`
+	}
+	if err := toml.Unmarshal(data, &raw); err != nil {
 		return ServiceConfig{}, err
 	}
+	cfg := ServiceConfig{
+		General:      raw.General,
+		Dependencies: raw.Dependencies,
+		Vars:         raw.Vars,
+		API:          raw.API,
+	}
+	if len(raw.Environment) > 0 {
+		cfg.Environment = make(map[string]map[string]string, len(raw.Environment))
+		for name, values := range raw.Environment {
+			converted := make(map[string]string, len(values))
+			for mode, value := range values {
+				converted[mode] = fmt.Sprint(value)
+			}
+			cfg.Environment[name] = converted
+		}
+	}
 	return cfg, nil
 }
 
@@ -101,9 +190,100 @@ func SaveServiceConfig(root, serviceName string, cfg ServiceConfig) error {
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
 		return err
 	}
-	data, err := toml.Marshal(cfg)
+	data, err := MarshalServiceConfig(cfg)
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(path, data, 0o644)
 }
+
+// MarshalServiceConfig encodes a service.toml, writing each environment variable
+// as a single inline table so that modes line up as columns.
+func MarshalServiceConfig(cfg ServiceConfig) ([]byte, error) {
+	head := struct {
+		General      GeneralConfig      `toml:"general"`
+		Dependencies DependenciesConfig `toml:"dependencies"`
+		Vars         map[string]any     `toml:"vars,omitempty"`
+		API          *APIConfig         `toml:"api,omitempty"`
+	}{
+		General:      cfg.General,
+		Dependencies: cfg.Dependencies,
+		Vars:         cfg.Vars,
+		API:          cfg.API,
+	}
+	data, err := toml.Marshal(head)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Environment) == 0 {
+		return data, nil
+	}
+
+	names := make([]string, 0, len(cfg.Environment))
+	width := 0
+	for name := range cfg.Environment {
+		names = append(names, name)
+		if n := len(tomlKey(name)); n > width {
+			width = n
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	buf.Write(data)
+	buf.WriteString("\n[environment]\n")
+	for _, name := range names {
+		values := cfg.Environment[name]
+		var pairs [][2]string
+		for _, mode := range sortedModes(values) {
+			pairs = append(pairs, [2]string{mode, values[mode]})
+		}
+		fmt.Fprintf(&buf, "%-*s = %s\n", width, tomlKey(name), inlineTable(pairs))
+	}
+	return buf.Bytes(), nil
+}
+
+func sortedModes(values map[string]string) []string {
+	var modes []string
+	for _, mode := range modeOrder {
+		if _, ok := values[mode]; ok {
+			modes = append(modes, mode)
+		}
+	}
+	var rest []string
+	for mode := range values {
+		known := false
+		for _, m := range modeOrder {
+			if m == mode {
+				known = true
+				break
+			}
+		}
+		if !known {
+			rest = append(rest, mode)
+		}
+	}
+	sort.Strings(rest)
+	return append(modes, rest...)
+}
+
+// inlineTable formats string pairs as a TOML inline table, in order.
+func inlineTable(pairs [][2]string) string {
+	kvs := make([]string, len(pairs))
+	for i, kv := range pairs {
+		kvs[i] = tomlKey(kv[0]) + " = " + strconv.Quote(kv[1])
+	}
+	return "{ " + strings.Join(kvs, ", ") + " }"
+}
+
+func tomlKey(key string) string {
+	for _, r := range key {
+		if !(r == '_' || r == '-' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return strconv.Quote(key)
+		}
+	}
+	if key == "" {
+		return `""`
+	}
+	return key
+}
@@ -0,0 +1,184 @@
+package diff
+
+import (
+	"bytes"
+)
+
+// Markers label the sides of a conflict written by Merge3.
+type Markers struct {
+	Ours   string
+	Base   string
+	Theirs string
+}
+
+// DefaultMarkers labels the local tree as ours and the pack output as theirs.
+var DefaultMarkers = Markers{
+	Ours:   "local",
+	Base:   "base",
+	Theirs: "pack",
+}
+
+// MergeResult is the outcome of a three-way merge.
+type MergeResult struct {
+	Content   []byte
+	Conflicts int
+}
+
+// SplitLines splits content into lines, keeping line terminators.
+func SplitLines(content []byte) []string {
+	if len(content) == 0 {
+		return nil
+	}
+	var lines []string
+	for len(content) > 0 {
+		i := bytes.IndexByte(content, '\n')
+		if i < 0 {
+			lines = append(lines, string(content))
+			break
+		}
+		lines = append(lines, string(content[:i+1]))
+		content = content[i+1:]
+	}
+	return lines
+}
+
+// Merge3 merges the changes from base to ours and from base to theirs.
+// Overlapping changes that differ are wrapped in conflict markers.
+func Merge3(base, ours, theirs []byte, markers Markers) MergeResult {
+	b := SplitLines(base)
+	o := SplitLines(ours)
+	t := SplitLines(theirs)
+
+	matchOurs := matchIndex(b, o)
+	matchTheirs := matchIndex(b, t)
+
+	var out bytes.Buffer
+	conflicts := 0
+	ib, io, it := 0, 0, 0
+	for {
+		// Emit the stable run where base, ours and theirs agree.
+		n := 0
+		for ib+n < len(b) && matchOurs[ib+n] == io+n && matchTheirs[ib+n] == it+n {
+			n++
+		}
+		writeLines(&out, b[ib:ib+n])
+		ib, io, it = ib+n, io+n, it+n
+		if ib >= len(b) && io >= len(o) && it >= len(t) {
+			break
+		}
+
+		// Find the next base line that both sides still contain.
+		next := ib
+		for next < len(b) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		eo, et := len(o), len(t)
+		if next < len(b) {
+			eo, et = matchOurs[next], matchTheirs[next]
+		}
+
+		baseChunk, oursChunk, theirsChunk := b[ib:next], o[io:eo], t[it:et]
+		switch {
+		case equalLines(oursChunk, baseChunk):
+			writeLines(&out, theirsChunk)
+		case equalLines(theirsChunk, baseChunk), equalLines(oursChunk, theirsChunk):
+			writeLines(&out, oursChunk)
+		default:
+			conflicts++
+			writeConflict(&out, markers, baseChunk, oursChunk, theirsChunk)
+		}
+		ib, io, it = next, eo, et
+	}
+
+	return MergeResult{Content: out.Bytes(), Conflicts: conflicts}
+}
+
+// Common returns the lines shared by a and b in order. It serves as a
+// synthetic base when no recorded ancestor exists, so that each differing
+// hunk becomes its own conflict instead of the whole file.
+func Common(a, b []byte) []byte {
+	al := SplitLines(a)
+	bl := SplitLines(b)
+	match := matchIndex(al, bl)
+	var out bytes.Buffer
+	for i, j := range match {
+		if j >= 0 {
+			out.WriteString(al[i])
+		}
+	}
+	return out.Bytes()
+}
+
+// matchIndex maps every line of a to the index of its partner in b along a
+// longest common subsequence, or -1 when the line is not part of it.
+func matchIndex(a, b []string) []int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	match := make([]int, len(a))
+	i, j := 0, 0
+	for i < len(a) {
+		switch {
+		case j < len(b) && a[i] == b[j]:
+			match[i] = j
+			i++
+			j++
+		case j < len(b) && lcs[i+1][j] < lcs[i][j+1]:
+			j++
+		default:
+			match[i] = -1
+			i++
+		}
+	}
+	return match
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func writeLines(buf *bytes.Buffer, lines []string) {
+	for _, line := range lines {
+		buf.WriteString(line)
+	}
+}
+
+func writeConflict(buf *bytes.Buffer, markers Markers, base, ours, theirs []string) {
+	buf.WriteString("<<<<<<< " + markers.Ours + "\n")
+	writeTerminated(buf, ours)
+	buf.WriteString("||||||| " + markers.Base + "\n")
+	writeTerminated(buf, base)
+	buf.WriteString("=======\n")
+	writeTerminated(buf, theirs)
+	buf.WriteString(">>>>>>> " + markers.Theirs + "\n")
+}
+
+// writeTerminated writes lines and makes sure the last one ends with a
+// newline so that the following marker starts on its own line.
+func writeTerminated(buf *bytes.Buffer, lines []string) {
+	writeLines(buf, lines)
+	if n := len(lines); n > 0 && len(lines[n-1]) > 0 && lines[n-1][len(lines[n-1])-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+}
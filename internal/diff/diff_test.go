@@ -0,0 +1,106 @@
+package diff
+
+import "testing"
+
+func TestMerge3(t *testing.T) {
+	tests := []struct {
+		name               string
+		base, ours, theirs string
+		want               string
+		conflicts          int
+	}{
+		{
+			name: "unchanged",
+			base: "a\nb\n", ours: "a\nb\n", theirs: "a\nb\n",
+			want: "a\nb\n",
+		},
+		{
+			name: "theirs only",
+			base: "a\nb\nc\n", ours: "a\nb\nc\n", theirs: "a\nB\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "ours only",
+			base: "a\nb\nc\n", ours: "a\nB\nc\n", theirs: "a\nb\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "separate changes",
+			base: "a\nb\nc\nd\ne\n", ours: "A\nb\nc\nd\ne\n", theirs: "a\nb\nc\nd\nE\n",
+			want: "A\nb\nc\nd\nE\n",
+		},
+		{
+			name: "same change on both sides",
+			base: "a\nb\nc\n", ours: "a\nB\nc\n", theirs: "a\nB\nc\n",
+			want: "a\nB\nc\n",
+		},
+		{
+			name: "deletion and change elsewhere",
+			base: "a\nb\nc\nd\n", ours: "a\nc\nd\n", theirs: "a\nb\nc\nD\n",
+			want: "a\nc\nD\n",
+		},
+		{
+			name: "conflicting change",
+			base: "a\nb\nc\n", ours: "a\nours\nc\n", theirs: "a\ntheirs\nc\n",
+			want:      "a\n<<<<<<< local\nours\n||||||| base\nb\n=======\ntheirs\n>>>>>>> pack\nc\n",
+			conflicts: 1,
+		},
+		{
+			name: "two conflicts",
+			base: "a\nb\nc\nd\ne\n", ours: "A1\nb\nc\nd\nE1\n", theirs: "A2\nb\nc\nd\nE2\n",
+			want:      "<<<<<<< local\nA1\n||||||| base\na\n=======\nA2\n>>>>>>> pack\nb\nc\nd\n<<<<<<< local\nE1\n||||||| base\ne\n=======\nE2\n>>>>>>> pack\n",
+			conflicts: 2,
+		},
+		{
+			name: "insertion at EOF by theirs",
+			base: "a\nb\n", ours: "a\nb\n", theirs: "a\nb\nc\n",
+			want: "a\nb\nc\n",
+		},
+		{
+			name: "insertion at EOF by ours with change by theirs",
+			base: "a\nb\nc\n", ours: "a\nb\nc\nmine\n", theirs: "A\nb\nc\n",
+			want: "A\nb\nc\nmine\n",
+		},
+		{
+			name: "same insertion at EOF",
+			base: "a\n", ours: "a\nz\n", theirs: "a\nz\n",
+			want: "a\nz\n",
+		},
+		{
+			name: "different insertions at EOF",
+			base: "a\n", ours: "a\nmine\n", theirs: "a\npack\n",
+			want:      "a\n<<<<<<< local\nmine\n||||||| base\n=======\npack\n>>>>>>> pack\n",
+			conflicts: 1,
+		},
+		{
+			name: "missing newline at EOF in a conflict",
+			base: "a\nb", ours: "a\nmine", theirs: "a\npack",
+			want:      "a\n<<<<<<< local\nmine\n||||||| base\nb\n=======\npack\n>>>>>>> pack\n",
+			conflicts: 1,
+		},
+		{
+			name: "empty base",
+			base: "", ours: "x\n", theirs: "y\n",
+			want:      "<<<<<<< local\nx\n||||||| base\n=======\ny\n>>>>>>> pack\n",
+			conflicts: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Merge3([]byte(tt.base), []byte(tt.ours), []byte(tt.theirs), DefaultMarkers)
+			if string(got.Content) != tt.want {
+				t.Errorf("content:\n%s\nwant:\n%s", got.Content, tt.want)
+			}
+			if got.Conflicts != tt.conflicts {
+				t.Errorf("conflicts = %d, want %d", got.Conflicts, tt.conflicts)
+			}
+		})
+	}
+}
+
+func TestCommon(t *testing.T) {
+	got := Common([]byte("a\nb\nc\nd\n"), []byte("a\nx\nc\nd\ny\n"))
+	if want := "a\nc\nd\n"; string(got) != want {
+		t.Errorf("Common = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,114 @@
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change.
+const contextLines = 3
+
+// op is one line of an edit script: ' ' keeps, '-' deletes and '+' inserts.
+type op struct {
+	kind byte
+	line string
+	// a and b are the number of old and new lines before this one.
+	a, b int
+}
+
+// Unified returns a unified diff turning a into b, labelled with the given
+// file names. It returns an empty string when the contents are equal.
+// Binary content is reported in a single line.
+func Unified(fromName, toName string, a, b []byte) string {
+	if bytes.Equal(a, b) {
+		return ""
+	}
+	if isBinary(a) || isBinary(b) {
+		return fmt.Sprintf("Binary files %s and %s differ\n", fromName, toName)
+	}
+
+	ops := editScript(SplitLines(a), SplitLines(b))
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// Extend the hunk while the next change is close enough to share context.
+		last := i
+		for j := i + 1; j < len(ops) && j <= last+2*contextLines; j++ {
+			if ops[j].kind != ' ' {
+				last = j
+			}
+		}
+		start := max(i-contextLines, 0)
+		end := min(last+contextLines+1, len(ops))
+		writeHunk(&out, ops[start:end])
+		i = end
+	}
+	return out.String()
+}
+
+func writeHunk(out *strings.Builder, ops []op) {
+	aLen, bLen := 0, 0
+	for _, o := range ops {
+		if o.kind != '+' {
+			aLen++
+		}
+		if o.kind != '-' {
+			bLen++
+		}
+	}
+	aStart, bStart := ops[0].a, ops[0].b
+	if aLen > 0 {
+		aStart++
+	}
+	if bLen > 0 {
+		bStart++
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+	for _, o := range ops {
+		out.WriteByte(o.kind)
+		out.WriteString(o.line)
+		if !strings.HasSuffix(o.line, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+func hunkRange(start, n int) string {
+	if n == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+// editScript lists the line operations turning a into b along a longest
+// common subsequence.
+func editScript(a, b []string) []op {
+	match := matchIndex(a, b)
+	var ops []op
+	j := 0
+	for i, m := range match {
+		if m < 0 {
+			ops = append(ops, op{kind: '-', line: a[i], a: i, b: j})
+			continue
+		}
+		for ; j < m; j++ {
+			ops = append(ops, op{kind: '+', line: b[j], a: i, b: j})
+		}
+		ops = append(ops, op{kind: ' ', line: a[i], a: i, b: j})
+		j++
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, op{kind: '+', line: b[j], a: len(a), b: j})
+	}
+	return ops
+}
+
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content, 0) >= 0
+}
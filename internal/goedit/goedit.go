@@ -0,0 +1,436 @@
+// Package goedit makes targeted additions to Go source files. Insertion points
+// are found with go/ast and the new code is spliced into the original text, so
+// the rest of a file, comments included, stays as it was. Edited files are
+// gofmt'ed before they are returned.
+package goedit
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Package holds the parsed non-test files of a package directory.
+type Package struct {
+	Name  string
+	Dir   string
+	Files []*File
+}
+
+// File is a parsed source file and the edits made to it so far.
+type File struct {
+	// Path is the file path, Dir joined with the file name.
+	Path string
+	Src  []byte
+	AST  *ast.File
+
+	fset  *token.FileSet
+	edits []edit
+	// added holds the imports to add, in the order of AddImport.
+	added []string
+	// local is the import path prefix of the project's own packages.
+	local string
+}
+
+type edit struct {
+	offset int
+	text   string
+}
+
+// LoadPackage parses the Go files of dir, skipping tests.
+func LoadPackage(dir string) (*Package, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	p := &Package{Dir: dir}
+	fset := token.NewFileSet()
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, path, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		if p.Name == "" {
+			p.Name = f.Name.Name
+		} else if f.Name.Name != p.Name {
+			return nil, fmt.Errorf("%s: found packages %s and %s", dir, p.Name, f.Name.Name)
+		}
+		p.Files = append(p.Files, &File{Path: path, Src: src, AST: f, fset: fset})
+	}
+	if len(p.Files) == 0 {
+		return nil, fmt.Errorf("%s: no Go files", dir)
+	}
+	return p, nil
+}
+
+// File returns the file with the given base name.
+func (p *Package) File(name string) *File {
+	for _, f := range p.Files {
+		if filepath.Base(f.Path) == name {
+			return f
+		}
+	}
+	return nil
+}
+
+// SetLocal sets the import path prefix of the project's packages, usually
+// its module path. AddImport puts them in the last group of an import block,
+// after the third-party packages, as goimports -local does.
+func (p *Package) SetLocal(prefix string) {
+	for _, f := range p.Files {
+		f.local = prefix
+	}
+}
+
+// Changed returns the files with edits.
+func (p *Package) Changed() []*File {
+	var files []*File
+	for _, f := range p.Files {
+		if len(f.edits) > 0 || len(f.added) > 0 {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Declares reports whether the package has a top-level declaration of name.
+func (p *Package) Declares(name string) bool {
+	for _, f := range p.Files {
+		if f.AST.Scope.Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Type returns the declaration of a named type.
+func (p *Package) Type(name string) (*File, *ast.TypeSpec) {
+	for _, f := range p.Files {
+		for _, decl := range f.AST.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				if ts := spec.(*ast.TypeSpec); ts.Name.Name == name {
+					return f, ts
+				}
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Func returns the declaration of a top-level function.
+func (p *Package) Func(name string) (*File, *ast.FuncDecl) {
+	return p.Method("", name)
+}
+
+// Method returns the declaration of a method of the named type, which may be
+// empty for a plain function.
+func (p *Package) Method(recv, name string) (*File, *ast.FuncDecl) {
+	for _, f := range p.Files {
+		for _, decl := range f.AST.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Name.Name == name && receiver(fn) == recv {
+				return f, fn
+			}
+		}
+	}
+	return nil, nil
+}
+
+// Const returns the value of a string constant.
+func (p *Package) Const(name string) (string, bool) {
+	for _, f := range p.Files {
+		obj := f.AST.Scope.Lookup(name)
+		if obj == nil || obj.Kind != ast.Con {
+			continue
+		}
+		spec, ok := obj.Decl.(*ast.ValueSpec)
+		if !ok {
+			continue
+		}
+		for i, n := range spec.Names {
+			if n.Name != name || i >= len(spec.Values) {
+				continue
+			}
+			if lit, ok := spec.Values[i].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				s, err := strconv.Unquote(lit.Value)
+				return s, err == nil
+			}
+		}
+	}
+	return "", false
+}
+
+// Implementation returns the type T asserted to implement iface, written as
+// in the source (e.g. "api.Service"), by a declaration such as
+//
+//	var _ api.Service = (*T)(nil)
+func (p *Package) Implementation(iface string) (string, bool) {
+	for _, f := range p.Files {
+		for _, decl := range f.AST.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.VAR {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				vs := spec.(*ast.ValueSpec)
+				if len(vs.Names) != 1 || vs.Names[0].Name != "_" || len(vs.Values) != 1 || vs.Type == nil {
+					continue
+				}
+				if Print(vs.Type) != iface {
+					continue
+				}
+				call, ok := vs.Values[0].(*ast.CallExpr)
+				if !ok {
+					continue
+				}
+				paren, ok := call.Fun.(*ast.ParenExpr)
+				if !ok {
+					continue
+				}
+				star, ok := paren.X.(*ast.StarExpr)
+				if !ok {
+					continue
+				}
+				if id, ok := star.X.(*ast.Ident); ok {
+					return id.Name, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// receiver returns the base type name of a method's receiver.
+func receiver(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return ""
+	}
+	typ := fn.Recv.List[0].Type
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	if id, ok := typ.(*ast.Ident); ok {
+		return id.Name
+	}
+	return ""
+}
+
+// Insert adds text at pos.
+func (f *File) Insert(pos token.Pos, text string) {
+	f.edits = append(f.edits, edit{offset: f.fset.Position(pos).Offset, text: text})
+}
+
+// InsertLine adds text at the start of the line holding pos. The text should
+// end with a newline.
+func (f *File) InsertLine(pos token.Pos, text string) {
+	offset := f.fset.Position(pos).Offset
+	offset = bytes.LastIndexByte(f.Src[:offset], '\n') + 1
+	f.edits = append(f.edits, edit{offset: offset, text: text})
+}
+
+// StartsLine reports whether only whitespace precedes pos on its line.
+func (f *File) StartsLine(pos token.Pos) bool {
+	offset := f.fset.Position(pos).Offset
+	line := f.Src[bytes.LastIndexByte(f.Src[:offset], '\n')+1 : offset]
+	return len(bytes.TrimSpace(line)) == 0
+}
+
+// Append adds text at the end of the file, after a blank line.
+func (f *File) Append(text string) {
+	sep := "\n"
+	if !bytes.HasSuffix(f.Src, []byte("\n")) {
+		sep = "\n\n"
+	}
+	f.edits = append(f.edits, edit{offset: len(f.Src), text: sep + text})
+}
+
+// ImportName returns the name under which the file imports path, or "" when
+// it does not.
+func (f *File) ImportName(path string) string {
+	for _, imp := range f.AST.Imports {
+		if p, _ := strconv.Unquote(imp.Path.Value); p != path {
+			continue
+		}
+		if imp.Name != nil {
+			return imp.Name.Name
+		}
+		return path[strings.LastIndex(path, "/")+1:]
+	}
+	return ""
+}
+
+// AddImport imports path unless the file already does. Imports are grouped
+// as goimports does: standard library packages first, then third-party
+// packages, then the project's own (see SetLocal). A path joins the
+// existing group of its kind, or a new group in that order.
+func (f *File) AddImport(path string) {
+	if f.ImportName(path) != "" || slices.Contains(f.added, path) {
+		return
+	}
+	f.added = append(f.added, path)
+}
+
+// Import groups, in the order they appear in an import block.
+const (
+	groupStdlib = iota
+	groupThirdParty
+	groupLocal
+)
+
+func (f *File) importGroup(path string) int {
+	if f.local != "" && (path == f.local || strings.HasPrefix(path, f.local+"/")) {
+		return groupLocal
+	}
+	first, _, _ := strings.Cut(path, "/")
+	if !strings.Contains(first, ".") {
+		return groupStdlib
+	}
+	return groupThirdParty
+}
+
+// importEdits returns the edits adding the imports of AddImport.
+func (f *File) importEdits() []edit {
+	if len(f.added) == 0 {
+		return nil
+	}
+	byGroup := make(map[int][]string)
+	for _, path := range f.added {
+		g := f.importGroup(path)
+		byGroup[g] = append(byGroup[g], strconv.Quote(path))
+	}
+	// specs returns the imports of group g, one per line.
+	specs := func(g int) string {
+		return strings.Join(byGroup[g], "\n\t")
+	}
+	offset := func(pos token.Pos) int {
+		return f.fset.Position(pos).Offset
+	}
+	kinds := []int{groupStdlib, groupThirdParty, groupLocal}
+
+	var gen *ast.GenDecl
+	for _, decl := range f.AST.Decls {
+		if d, ok := decl.(*ast.GenDecl); ok && d.Tok == token.IMPORT {
+			gen = d
+			break
+		}
+	}
+	switch {
+	case gen == nil:
+		var groups []string
+		for _, g := range kinds {
+			if len(byGroup[g]) > 0 {
+				groups = append(groups, specs(g))
+			}
+		}
+		return []edit{{offset: offset(f.AST.Name.End()), text: "\n\nimport (\n\t" + strings.Join(groups, "\n\n\t") + "\n)"}}
+	case !gen.Lparen.IsValid():
+		var edits []edit
+		for _, path := range f.added {
+			edits = append(edits, edit{offset: offset(gen.End()), text: "\nimport " + strconv.Quote(path)})
+		}
+		return edits
+	}
+
+	// The existing groups, separated by blank lines, each of the kind of
+	// its first import.
+	type group struct {
+		kind       int
+		first, end token.Pos
+	}
+	var existing []group
+	prevLine := 0
+	for _, spec := range gen.Specs {
+		imp := spec.(*ast.ImportSpec)
+		line := f.fset.Position(imp.Pos()).Line
+		if len(existing) == 0 || line > prevLine+1 {
+			path, _ := strconv.Unquote(imp.Path.Value)
+			existing = append(existing, group{kind: f.importGroup(path), first: imp.Pos()})
+		}
+		existing[len(existing)-1].end = imp.End()
+		prevLine = f.fset.Position(imp.End()).Line
+	}
+
+	var edits []edit
+	for _, g := range kinds {
+		if len(byGroup[g]) == 0 {
+			continue
+		}
+		if len(existing) == 0 {
+			edits = append(edits, edit{offset: offset(gen.Lparen + 1), text: "\n\t" + specs(g)})
+			continue
+		}
+		at := -1
+		for i, e := range existing {
+			if e.kind >= g {
+				at = i
+				break
+			}
+		}
+		switch {
+		case at >= 0 && existing[at].kind == g:
+			// The last group of the kind, gofmt sorts it.
+			for at+1 < len(existing) && existing[at+1].kind == g {
+				at++
+			}
+			edits = append(edits, edit{offset: offset(existing[at].end), text: "\n\t" + specs(g)})
+		case at >= 0:
+			edits = append(edits, edit{offset: offset(existing[at].first), text: specs(g) + "\n\n\t"})
+		default:
+			edits = append(edits, edit{offset: offset(existing[len(existing)-1].end), text: "\n\n\t" + specs(g)})
+		}
+	}
+	return edits
+}
+
+// Format returns the edited source, gofmt'ed.
+func (f *File) Format() ([]byte, error) {
+	// Edits at the same offset keep the order they were made in.
+	edits := append(f.importEdits(), f.edits...)
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].offset < edits[j].offset
+	})
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range edits {
+		buf.Write(f.Src[last:e.offset])
+		buf.WriteString(e.text)
+		last = e.offset
+	}
+	buf.Write(f.Src[last:])
+	out, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("%s: edited source does not parse: %w", f.Path, err)
+	}
+	return out, nil
+}
+
+// Print returns the gofmt'ed source of an AST node without positions.
+func Print(node any) string {
+	var buf bytes.Buffer
+	if err := format.Node(&buf, token.NewFileSet(), node); err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return buf.String()
+}
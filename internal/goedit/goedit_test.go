@@ -0,0 +1,178 @@
+package goedit
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadFile parses src as the only file of a package in the project "shop".
+func loadFile(t *testing.T, src string) (*Package, *File) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPackage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.SetLocal("shop")
+	return p, p.Files[0]
+}
+
+func TestAddImportGroups(t *testing.T) {
+	tests := []struct {
+		name    string
+		src     string
+		imports []string
+		want    string
+	}{
+		{
+			name: "existing groups",
+			src: `package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"shop/common/std"
+)
+`,
+			imports: []string{"shop/services/orders/api", "context", "github.com/google/uuid"},
+			want: `package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"shop/common/std"
+	"shop/services/orders/api"
+)
+`,
+		},
+		{
+			name: "new groups after",
+			src: `package main
+
+import (
+	"fmt"
+)
+`,
+			imports: []string{"shop/services/orders/api", "github.com/gin-gonic/gin", "errors"},
+			want: `package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+
+	"shop/services/orders/api"
+)
+`,
+		},
+		{
+			name: "new groups before",
+			src: `package main
+
+import (
+	"shop/services/orders/api"
+)
+
+var _ api.Service
+`,
+			imports: []string{"github.com/gin-gonic/gin", "context"},
+			want: `package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"shop/services/orders/api"
+)
+
+var _ api.Service
+`,
+		},
+		{
+			name: "new group between",
+			src: `package main
+
+import (
+	"context"
+
+	"shop/services/orders/api"
+)
+`,
+			imports: []string{"github.com/gin-gonic/gin"},
+			want: `package main
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"shop/services/orders/api"
+)
+`,
+		},
+		{
+			name:    "no import block",
+			src:     "package main\n\nfunc main() {}\n",
+			imports: []string{"shop/services/orders/api", "context", "context"},
+			want: `package main
+
+import (
+	"context"
+
+	"shop/services/orders/api"
+)
+
+func main() {}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, f := loadFile(t, tt.src)
+			for _, path := range tt.imports {
+				f.AddImport(path)
+			}
+			got, err := f.Format()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddImportKeepsExisting(t *testing.T) {
+	p, f := loadFile(t, `package main
+
+import (
+	"context"
+
+	orders "shop/services/orders/api"
+)
+
+var _ orders.Service
+var _ context.Context
+`)
+	f.AddImport("context")
+	f.AddImport("shop/services/orders/api")
+	if changed := p.Changed(); len(changed) != 0 {
+		t.Errorf("%d files changed by imports already present", len(changed))
+	}
+	if name := f.ImportName("shop/services/orders/api"); name != "orders" {
+		t.Errorf("ImportName = %q, want orders", name)
+	}
+}
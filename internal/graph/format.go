@@ -0,0 +1,156 @@
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Output formats supported by Write.
+const (
+	FormatDOT     = "dot"
+	FormatMermaid = "mermaid"
+	FormatJSON    = "json"
+)
+
+// Write renders the graph in the given format.
+func Write(w io.Writer, g *Graph, format string) error {
+	switch format {
+	case FormatDOT:
+		return writeDOT(w, g)
+	case FormatMermaid:
+		return writeMermaid(w, g)
+	case FormatJSON:
+		return writeJSON(w, g)
+	default:
+		return fmt.Errorf("unknown graph format %q (dot, mermaid, json)", format)
+	}
+}
+
+// jsonNode is the JSON representation of a node.
+type jsonNode struct {
+	Name         string   `json:"name"`
+	External     bool     `json:"external,omitempty"`
+	Database     string   `json:"database,omitempty"`
+	Missing      bool     `json:"missing,omitempty"`
+	Dependencies []string `json:"dependencies"`
+}
+
+func writeJSON(w io.Writer, g *Graph) error {
+	nodes := make([]jsonNode, 0, len(g.nodes))
+	for _, name := range g.Names() {
+		n := g.nodes[name]
+		deps := n.Config.Dependencies.Services
+		if deps == nil {
+			deps = []string{}
+		}
+		nodes = append(nodes, jsonNode{
+			Name:         n.Name,
+			External:     n.Config.General.External,
+			Database:     n.Config.General.Database,
+			Missing:      n.Missing,
+			Dependencies: deps,
+		})
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		Services []jsonNode `json:"services"`
+	}{Services: nodes})
+}
+
+func writeDOT(w io.Writer, g *Graph) error {
+	var b strings.Builder
+	b.WriteString("digraph services {\n")
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	for _, name := range g.Names() {
+		n := g.nodes[name]
+		var attrs []string
+		attrs = append(attrs, "label="+strconv.Quote(nodeLabel(n)))
+		switch {
+		case n.Missing:
+			attrs = append(attrs, `style=dashed`, `color=red`)
+		case n.Config.General.External:
+			attrs = append(attrs, `style="rounded,dashed"`)
+		}
+		if n.Config.HasDatabase() {
+			attrs = append(attrs, `shape=cylinder`)
+		}
+		fmt.Fprintf(&b, "  %s [%s];\n", strconv.Quote(name), strings.Join(attrs, ", "))
+	}
+	for _, name := range g.Names() {
+		for _, dep := range g.Dependencies(name) {
+			fmt.Fprintf(&b, "  %s -> %s;\n", strconv.Quote(name), strconv.Quote(dep))
+		}
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeMermaid(w io.Writer, g *Graph) error {
+	ids := make(map[string]string)
+	for i, name := range g.Names() {
+		ids[name] = fmt.Sprintf("s%d", i)
+	}
+
+	var b strings.Builder
+	b.WriteString("graph LR\n")
+	var external, missing, database []string
+	for _, name := range g.Names() {
+		n := g.nodes[name]
+		label := strings.ReplaceAll(nodeLabel(n), `"`, "#quot;")
+		if n.Config.HasDatabase() {
+			fmt.Fprintf(&b, "  %s[(\"%s\")]\n", ids[name], label)
+			database = append(database, ids[name])
+		} else {
+			fmt.Fprintf(&b, "  %s[\"%s\"]\n", ids[name], label)
+		}
+		switch {
+		case n.Missing:
+			missing = append(missing, ids[name])
+		case n.Config.General.External:
+			external = append(external, ids[name])
+		}
+	}
+	for _, name := range g.Names() {
+		for _, dep := range g.Dependencies(name) {
+			fmt.Fprintf(&b, "  %s --> %s\n", ids[name], ids[dep])
+		}
+	}
+	b.WriteString("  classDef external stroke-dasharray: 5 5\n")
+	b.WriteString("  classDef missing stroke:#d00,stroke-dasharray: 5 5\n")
+	b.WriteString("  classDef database fill:#eef\n")
+	writeClass(&b, "external", external)
+	writeClass(&b, "missing", missing)
+	writeClass(&b, "database", database)
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeClass(b *strings.Builder, class string, ids []string) {
+	if len(ids) > 0 {
+		fmt.Fprintf(b, "  class %s %s\n", strings.Join(ids, ","), class)
+	}
+}
+
+// nodeLabel describes a node including its markers.
+func nodeLabel(n *Node) string {
+	var tags []string
+	switch {
+	case n.Missing:
+		tags = append(tags, "missing")
+	case n.Config.General.External:
+		tags = append(tags, "external")
+	}
+	if n.Config.HasDatabase() {
+		tags = append(tags, "db: "+n.Config.General.Database)
+	}
+	if len(tags) == 0 {
+		return n.Name
+	}
+	return fmt.Sprintf("%s (%s)", n.Name, strings.Join(tags, ", "))
+}
@@ -0,0 +1,176 @@
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"micromanager/internal/config"
+)
+
+// Node is a service in the dependency graph.
+type Node struct {
+	Name   string
+	Config config.ServiceConfig
+	// Missing marks services that are declared as a dependency but have no service.toml.
+	Missing bool
+}
+
+// Graph is the dependency graph of the services in a repository.
+type Graph struct {
+	nodes map[string]*Node
+}
+
+// CycleError reports a dependency cycle. Path starts and ends with the same service.
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(e.Path, " -> "))
+}
+
+// Load reads every service config under services/ and builds the graph.
+func Load(root string) (*Graph, error) {
+	names, err := config.ListServices(root)
+	if err != nil {
+		return nil, err
+	}
+	g := &Graph{nodes: make(map[string]*Node)}
+	for _, name := range names {
+		cfg, err := config.LoadServiceConfig(root, name)
+		if err != nil {
+			return nil, fmt.Errorf("load %s config: %w", name, err)
+		}
+		g.nodes[name] = &Node{Name: name, Config: cfg}
+	}
+	for _, name := range names {
+		for _, dep := range g.nodes[name].Config.Dependencies.Services {
+			if _, ok := g.nodes[dep]; !ok {
+				g.nodes[dep] = &Node{Name: dep, Missing: true}
+			}
+		}
+	}
+	return g, nil
+}
+
+// Names returns all nodes, including missing ones, sorted by name.
+func (g *Graph) Names() []string {
+	names := make([]string, 0, len(g.nodes))
+	for name := range g.nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Node returns the node for a service.
+func (g *Graph) Node(name string) (*Node, bool) {
+	n, ok := g.nodes[name]
+	return n, ok
+}
+
+// Dependencies returns the direct dependencies of a service.
+func (g *Graph) Dependencies(name string) []string {
+	n, ok := g.nodes[name]
+	if !ok {
+		return nil
+	}
+	return n.Config.Dependencies.Services
+}
+
+// Order returns the targets and their transitive dependencies so that every
+// service comes after the services it depends on. With no targets, every
+// service is included.
+func (g *Graph) Order(targets []string) ([]string, error) {
+	if len(targets) == 0 {
+		for _, name := range g.Names() {
+			if !g.nodes[name].Missing {
+				targets = append(targets, name)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int)
+	var order, stack []string
+
+	var visit func(name, from string) error
+	visit = func(name, from string) error {
+		n, ok := g.nodes[name]
+		if !ok || n.Missing {
+			if from == "" {
+				return fmt.Errorf("service %q not found", name)
+			}
+			return fmt.Errorf("service %q depends on %q, which has no service.toml", from, name)
+		}
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			start := 0
+			for i, s := range stack {
+				if s == name {
+					start = i
+					break
+				}
+			}
+			path := append(append([]string{}, stack[start:]...), name)
+			return &CycleError{Path: path}
+		}
+
+		state[name] = visiting
+		stack = append(stack, name)
+		for _, dep := range n.Config.Dependencies.Services {
+			if err := visit(dep, name); err != nil {
+				return err
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[name] = visited
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range targets {
+		if err := visit(name, ""); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Dependents returns every service that depends on name directly or
+// transitively, sorted by name.
+func (g *Graph) Dependents(name string) []string {
+	reverse := make(map[string][]string)
+	for _, n := range g.nodes {
+		for _, dep := range n.Config.Dependencies.Services {
+			reverse[dep] = append(reverse[dep], n.Name)
+		}
+	}
+
+	seen := make(map[string]bool)
+	queue := []string{name}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, dependent := range reverse[cur] {
+			if !seen[dependent] && dependent != name {
+				seen[dependent] = true
+				queue = append(queue, dependent)
+			}
+		}
+	}
+
+	dependents := make([]string, 0, len(seen))
+	for dependent := range seen {
+		dependents = append(dependents, dependent)
+	}
+	sort.Strings(dependents)
+	return dependents
+}
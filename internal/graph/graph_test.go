@@ -0,0 +1,140 @@
+package graph
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// loadGraph writes a service.toml for every service with its dependencies
+// and loads the graph.
+func loadGraph(t *testing.T, deps map[string][]string) *Graph {
+	t.Helper()
+	root := t.TempDir()
+	for name, services := range deps {
+		quoted := make([]string, len(services))
+		for i, s := range services {
+			quoted[i] = strconv.Quote(s)
+		}
+		content := fmt.Sprintf("[general]\nlang = \"go\"\n\n[dependencies]\nservices = [%s]\n", strings.Join(quoted, ", "))
+		dir := filepath.Join(root, "services", name)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "service.toml"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := Load(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// shop is a graph without cycles: admin uses the gateway, which calls
+// orders and users; orders needs payments and users, payments needs users.
+var shop = map[string][]string{
+	"admin":    {"gateway"},
+	"gateway":  {"orders", "users"},
+	"orders":   {"users", "payments"},
+	"payments": {"users"},
+	"users":    nil,
+}
+
+func TestOrder(t *testing.T) {
+	g := loadGraph(t, shop)
+	tests := []struct {
+		targets []string
+		want    []string
+	}{
+		{nil, []string{"users", "payments", "orders", "gateway", "admin"}},
+		{[]string{"orders"}, []string{"users", "payments", "orders"}},
+		{[]string{"payments", "users"}, []string{"users", "payments"}},
+		{[]string{"users"}, []string{"users"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.targets, ","), func(t *testing.T) {
+			got, err := g.Order(tt.targets)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Order(%v) = %v, want %v", tt.targets, got, tt.want)
+			}
+			pos := make(map[string]int)
+			for i, name := range got {
+				pos[name] = i
+			}
+			for _, name := range got {
+				for _, dep := range g.Dependencies(name) {
+					if pos[dep] > pos[name] {
+						t.Errorf("%s comes before its dependency %s", name, dep)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestOrderCycle(t *testing.T) {
+	g := loadGraph(t, map[string][]string{
+		"api":     {"billing"},
+		"billing": {"ledger"},
+		"ledger":  {"audit"},
+		"audit":   {"billing"},
+	})
+	_, err := g.Order([]string{"api"})
+	var cycle *CycleError
+	if !errors.As(err, &cycle) {
+		t.Fatalf("Order error = %v, want a cycle", err)
+	}
+	if want := []string{"billing", "ledger", "audit", "billing"}; !reflect.DeepEqual(cycle.Path, want) {
+		t.Errorf("cycle path = %v, want %v", cycle.Path, want)
+	}
+	if want := "dependency cycle: billing -> ledger -> audit -> billing"; err.Error() != want {
+		t.Errorf("error = %q, want %q", err, want)
+	}
+}
+
+func TestOrderMissing(t *testing.T) {
+	g := loadGraph(t, map[string][]string{"orders": {"ghost"}})
+	if n, ok := g.Node("ghost"); !ok || !n.Missing {
+		t.Errorf("ghost node = %+v, want missing", n)
+	}
+	if _, err := g.Order(nil); err == nil || err.Error() != `service "orders" depends on "ghost", which has no service.toml` {
+		t.Errorf("Order error = %v", err)
+	}
+	if _, err := g.Order([]string{"nope"}); err == nil || err.Error() != `service "nope" not found` {
+		t.Errorf("Order error = %v", err)
+	}
+}
+
+func TestDependents(t *testing.T) {
+	g := loadGraph(t, shop)
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"users", []string{"admin", "gateway", "orders", "payments"}},
+		{"payments", []string{"admin", "gateway", "orders"}},
+		{"gateway", []string{"admin"}},
+		{"admin", []string{}},
+	}
+	for _, tt := range tests {
+		if got := g.Dependents(tt.name); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Dependents(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	// A service on a cycle is not its own dependent.
+	g = loadGraph(t, map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b"}})
+	if got, want := g.Dependents("b"), []string{"a", "c"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Dependents(b) = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,180 @@
+package lang
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"micromanager/internal/config"
+)
+
+// DefaultAPIFile is the pack template declaring the API of new services. It
+// is rendered to services/<name>/api.toml like any other template. A service
+// type may declare its own in templates/service/<type>/api.toml.
+var DefaultAPIFile = path.Join("templates", "service", config.APIFile)
+
+// defaultAPIFile returns the default API template for a service type.
+func defaultAPIFile(p Pack, serviceType string) string {
+	if serviceType != "" {
+		if file := path.Join("templates", "service", serviceType, config.APIFile); fsExists(p.FS, file) {
+			return file
+		}
+	}
+	return DefaultAPIFile
+}
+
+// APIData is the API definition of a service as seen by templates.
+type APIData struct {
+	Operations []OperationData
+	Types      []TypeData
+}
+
+// OperationData is an operation with its request fields split by where
+// they are bound from.
+type OperationData struct {
+	Name string
+	// Method is upper case, e.g. "POST".
+	Method string
+	// Path uses ":name" for parameters.
+	Path     string
+	Request  string
+	Response string
+	Doc      string
+	// Body reports whether the request is sent as JSON.
+	Body bool
+	// PathParams and Query are the request fields bound from the path and
+	// from the query string.
+	PathParams []FieldData
+	Query      []FieldData
+}
+
+// TypeData is a struct type of the API.
+type TypeData struct {
+	Name   string
+	Doc    string
+	Fields []FieldData
+}
+
+// FieldData is a struct field. Tag is the complete Go struct tag and
+// NameCol and TypeCol are Name and Type padded as gofmt aligns them.
+type FieldData struct {
+	Name    string
+	Type    string
+	JSON    string
+	Binding string
+	Tag     string
+	NameCol string
+	TypeCol string
+}
+
+// LoadTemplateData returns NewTemplateData with the API definition of the
+// service loaded. Without one, Render uses the pack's default API.
+func LoadTemplateData(root, serviceName string, cfg config.ServiceConfig) (TemplateData, error) {
+	vars := NewTemplateData(root, serviceName, cfg)
+	api, err := config.LoadAPI(root, serviceName, cfg)
+	if err != nil {
+		return vars, fmt.Errorf("%s: %w", serviceName, err)
+	}
+	if api != nil {
+		vars.API = NewAPIData(*api)
+	}
+	return vars, nil
+}
+
+// NewAPIData prepares a validated API definition for templates.
+func NewAPIData(api config.APIConfig) *APIData {
+	// Tags depend on how the operations using a type bind it.
+	uri := make(map[string]map[string]bool)
+	form := make(map[string]bool)
+	for _, op := range api.Operations {
+		if op.Request == "" {
+			continue
+		}
+		if uri[op.Request] == nil {
+			uri[op.Request] = make(map[string]bool)
+		}
+		for _, p := range op.PathParams() {
+			uri[op.Request][p] = true
+		}
+		if !op.HasBody() {
+			form[op.Request] = true
+		}
+	}
+
+	data := &APIData{}
+	fields := make(map[string][]FieldData)
+	for _, t := range api.Types {
+		td := TypeData{Name: t.Name, Doc: t.Doc}
+		nameWidth, typeWidth := 0, 0
+		for _, f := range t.Fields {
+			nameWidth = max(nameWidth, len(f.Name))
+			typeWidth = max(typeWidth, len(f.Type))
+		}
+		for _, f := range t.Fields {
+			name := f.JSONName()
+			tags := []string{fmt.Sprintf("json:%q", name)}
+			if uri[t.Name][name] {
+				tags = append(tags, fmt.Sprintf("uri:%q", name))
+			} else if form[t.Name] {
+				tags = append(tags, fmt.Sprintf("form:%q", name))
+			}
+			if f.Binding != "" {
+				tags = append(tags, fmt.Sprintf("binding:%q", f.Binding))
+			}
+			td.Fields = append(td.Fields, FieldData{
+				Name:    f.Name,
+				Type:    f.Type,
+				JSON:    name,
+				Binding: f.Binding,
+				Tag:     strings.Join(tags, " "),
+				NameCol: f.Name + strings.Repeat(" ", nameWidth-len(f.Name)+1),
+				TypeCol: f.Type + strings.Repeat(" ", typeWidth-len(f.Type)+1),
+			})
+		}
+		fields[t.Name] = td.Fields
+		data.Types = append(data.Types, td)
+	}
+
+	for _, op := range api.Operations {
+		od := OperationData{
+			Name:     op.Name,
+			Method:   strings.ToUpper(op.Method),
+			Path:     op.RoutePath(),
+			Request:  op.Request,
+			Response: op.Response,
+			Doc:      op.Doc,
+			Body:     op.HasBody(),
+		}
+		params := make(map[string]bool)
+		for _, p := range op.PathParams() {
+			params[p] = true
+		}
+		for _, f := range fields[op.Request] {
+			switch {
+			case params[f.JSON]:
+				od.PathParams = append(od.PathParams, f)
+			case !od.Body:
+				od.Query = append(od.Query, f)
+			}
+		}
+		data.Operations = append(data.Operations, od)
+	}
+	return data
+}
+
+// defaultAPI renders the pack's default API definition, if it has one.
+func defaultAPI(p Pack, vars TemplateData) (*APIData, error) {
+	file := defaultAPIFile(p, vars.Type)
+	if !fsExists(p.FS, file) {
+		return nil, nil
+	}
+	content, err := renderTemplateFile(p.FS, file, vars)
+	if err != nil || content == nil {
+		return nil, err
+	}
+	api, err := config.ParseAPI(content)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return NewAPIData(*api), nil
+}
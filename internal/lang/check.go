@@ -0,0 +1,273 @@
+package lang
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	toml "github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// Problem is a defect found in a pack template.
+type Problem struct {
+	// File is the template path relative to the pack root.
+	File string
+	// Line is the line in the template, or in Output when it is set.
+	Line int
+	// Output is the rendered file the problem was found in.
+	Output string
+	Msg    string
+}
+
+func (p Problem) String() string {
+	loc := p.File
+	if loc == "" {
+		loc = "pack"
+	}
+	switch {
+	case p.Output != "" && p.Line > 0:
+		loc += fmt.Sprintf(" (%s:%d)", p.Output, p.Line)
+	case p.Output != "":
+		loc += fmt.Sprintf(" (%s)", p.Output)
+	case p.Line > 0:
+		loc += ":" + strconv.Itoa(p.Line)
+	}
+	return loc + ": " + p.Msg
+}
+
+// Sample template data used to render packs during checks.
+const (
+	sampleProject = "example.com/sample"
+	sampleService = "sample-svc"
+)
+
+// CheckTemplates parses every template of the pack and renders the pack
+// with sample data for every service type, once without a database and once
+// per supported database. Go outputs are parsed with go/parser, TOML, YAML and JSON
+// outputs are syntax-checked, and keep-block markers must pair up.
+func CheckTemplates(p Pack) []Problem {
+	problems := parseTemplates(p)
+	if len(problems) > 0 {
+		// Rendering would only repeat the parse errors.
+		return problems
+	}
+
+	seen := make(map[string]bool)
+	add := func(pr Problem) {
+		if key := pr.String(); !seen[key] {
+			seen[key] = true
+			problems = append(problems, pr)
+		}
+	}
+	types := ServiceTypeNames(p)
+	if len(types) == 0 {
+		types = []string{""}
+	}
+	for _, typ := range types {
+		for _, db := range append([]string{""}, Databases(p)...) {
+			vars := TemplateData{ProjectName: sampleProject, ServiceName: sampleService, Database: db, Type: typ}
+			// Check what rendered even when other templates failed.
+			files, err := render(p, vars)
+			for _, pr := range renderProblems(err) {
+				add(pr)
+			}
+			for _, f := range files {
+				for _, pr := range checkOutput(f) {
+					add(pr)
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// parseTemplates parses every template file of the pack.
+func parseTemplates(p Pack) []Problem {
+	var problems []Problem
+	err := fs.WalkDir(p.FS, "templates", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		if !isLikelyText(name) && !strings.HasSuffix(name, ".tmpl") {
+			return nil
+		}
+		if strings.Contains(name, "{{") {
+			for _, seg := range strings.Split(name, "/") {
+				if _, err := template.New(name).Funcs(templateFuncMap()).Parse(seg); err != nil {
+					problems = append(problems, Problem{File: name, Msg: "file name: " + err.Error()})
+				}
+			}
+		}
+		raw, err := fs.ReadFile(p.FS, name)
+		if err != nil {
+			return err
+		}
+		fm, body, err := splitFrontMatter(raw)
+		if err != nil {
+			problems = append(problems, Problem{File: name, Line: 1, Msg: err.Error()})
+			return nil
+		}
+		if fm.When != "" {
+			if _, err := template.New(name).Funcs(templateFuncMap()).Parse("{{if " + fm.When + "}}{{end}}"); err != nil {
+				problems = append(problems, Problem{File: name, Line: 2, Msg: "front-matter when: " + templateProblem(err).Msg})
+			}
+		}
+		if _, err := template.New(name).Funcs(templateFuncMap()).Parse(string(body)); err != nil {
+			pr := templateProblem(err)
+			// Point at the template line, counting the stripped front-matter.
+			if pr.Line > 0 {
+				pr.Line += bytes.Count(raw[:len(raw)-len(body)], []byte("\n"))
+			}
+			problems = append(problems, pr)
+		}
+		return nil
+	})
+	if err != nil {
+		problems = append(problems, Problem{Msg: err.Error()})
+	}
+	return problems
+}
+
+// renderProblems turns the joined errors of render into problems.
+func renderProblems(err error) []Problem {
+	if err == nil {
+		return nil
+	}
+	errs := []error{err}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	}
+	var problems []Problem
+	for _, err := range errs {
+		if _, ok := err.(interface{ Unwrap() []error }); ok {
+			problems = append(problems, renderProblems(err)...)
+			continue
+		}
+		var te *templateError
+		if !errors.As(err, &te) {
+			problems = append(problems, templateProblem(err))
+			continue
+		}
+		// The template name in the message may be that of a condition or
+		// file name segment rather than the file at fault.
+		msg := templateProblem(te.err).Msg
+		if te.what != "" {
+			msg = te.what + ": " + msg
+		}
+		problems = append(problems, Problem{File: te.file, Line: te.line, Msg: msg})
+	}
+	return problems
+}
+
+var templateErrRe = regexp.MustCompile(`template: ([^:]+):(\d+)(?::\d+)?: (.*)`)
+
+// templateProblem extracts the template name and line from a text/template error.
+func templateProblem(err error) Problem {
+	m := templateErrRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return Problem{Msg: err.Error()}
+	}
+	line, _ := strconv.Atoi(m[2])
+	return Problem{File: m[1], Line: line, Msg: m[3]}
+}
+
+var yamlLineRe = regexp.MustCompile(`line (\d+):`)
+
+// checkOutput syntax-checks a rendered file by its extension.
+func checkOutput(f File) []Problem {
+	tpl := path.Join("templates", f.Template)
+	problem := func(line int, msg string) Problem {
+		return Problem{File: tpl, Output: f.Path, Line: line, Msg: msg}
+	}
+
+	if _, err := ParseKeepBlocks(f.Content); err != nil {
+		return []Problem{problem(0, err.Error())}
+	}
+
+	switch path.Ext(f.Path) {
+	case ".go":
+		_, err := parser.ParseFile(token.NewFileSet(), f.Path, f.Content, 0)
+		var list scanner.ErrorList
+		if errors.As(err, &list) && len(list) > 0 {
+			// Later errors are mostly follow-ups of the first one.
+			return []Problem{problem(list[0].Pos.Line, list[0].Msg)}
+		}
+		if err != nil {
+			return []Problem{problem(0, err.Error())}
+		}
+	case ".toml":
+		var v map[string]any
+		err := toml.Unmarshal(f.Content, &v)
+		var decodeErr *toml.DecodeError
+		if errors.As(err, &decodeErr) {
+			row, _ := decodeErr.Position()
+			return []Problem{problem(row, decodeErr.Error())}
+		}
+		if err != nil {
+			return []Problem{problem(0, err.Error())}
+		}
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(f.Content))
+		for {
+			var v any
+			err := dec.Decode(&v)
+			if err == nil {
+				continue
+			}
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			line := 0
+			if m := yamlLineRe.FindStringSubmatch(err.Error()); m != nil {
+				line, _ = strconv.Atoi(m[1])
+			}
+			return []Problem{problem(line, err.Error())}
+		}
+	case ".json":
+		var v any
+		err := json.Unmarshal(f.Content, &v)
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := bytes.Count(f.Content[:syntaxErr.Offset], []byte("\n")) + 1
+			return []Problem{problem(line, syntaxErr.Error())}
+		}
+		if err != nil {
+			return []Problem{problem(0, err.Error())}
+		}
+	}
+	return nil
+}
+
+// problemsError joins problems into one error, sorted; it is nil when there
+// are none.
+func problemsError(problems []Problem) error {
+	SortProblems(problems)
+	errs := make([]error, len(problems))
+	for i, pr := range problems {
+		errs[i] = errors.New(pr.String())
+	}
+	return errors.Join(errs...)
+}
+
+// SortProblems orders problems by file and line.
+func SortProblems(problems []Problem) {
+	sort.SliceStable(problems, func(i, j int) bool {
+		if problems[i].File != problems[j].File {
+			return problems[i].File < problems[j].File
+		}
+		return problems[i].Line < problems[j].Line
+	})
+}
@@ -0,0 +1,49 @@
+package lang
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheckTemplatesCollectsRenderErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"pack.toml": {Data: []byte(`
+id = "broken"
+lang = "go"
+version = "0.1.0"
+
+[[files]]
+path = "templates/common"
+when = 'eq .Missing "x"'
+`)},
+		// A front-matter condition that fails once executed.
+		"templates/service/cond.go.tmpl": {Data: []byte("+++\nwhen = 'eq .Nope \"x\"'\n+++\npackage main\n")},
+		"templates/service/body.go.tmpl": {Data: []byte("+++\nwhen = 'true'\n+++\npackage main\n\n// {{.Undefined}}\n")},
+		"templates/service/ok.go.tmpl":   {Data: []byte("package main\n\nfunc {{\"broken\"}}( {}\n")},
+		// Only rendered with the database.
+		"templates/database/postgres/db.go.tmpl": {Data: []byte("package main\n\n{{.Database.Nope}}\n")},
+		"templates/common/lib.go.tmpl":           {Data: []byte("package lib\n")},
+	}
+	p, err := LoadPackFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []Problem
+	for _, pr := range CheckTemplates(p) {
+		pr.Msg = ""
+		got = append(got, pr)
+	}
+	SortProblems(got)
+	want := []Problem{
+		{File: "pack.toml"},
+		{File: "templates/database/postgres/db.go.tmpl", Line: 3},
+		{File: "templates/service/body.go.tmpl", Line: 6},
+		{File: "templates/service/cond.go.tmpl", Line: 2},
+		{File: "templates/service/ok.go.tmpl", Output: "services/sample-svc/ok.go", Line: 3},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("problems:\n got %v\nwant %v", got, want)
+	}
+}
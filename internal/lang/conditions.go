@@ -0,0 +1,131 @@
+package lang
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"text/template"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// FileCondition limits when files of a pack are rendered. Path is relative
+// to the pack root and names a file, a directory or a path.Match pattern,
+// e.g. "templates/service/client". When is a template pipeline such as
+// `ne .Database ""`; the files are rendered only if it is true.
+type FileCondition struct {
+	Path string `toml:"path"`
+	When string `toml:"when"`
+}
+
+// FrontMatter is the optional TOML header of a template, delimited by
+// "+++" lines at the very top of the file:
+//
+//	+++
+//	when = 'ne .Database ""'
+//	+++
+type FrontMatter struct {
+	When string `toml:"when"`
+}
+
+const frontMatterDelim = "+++"
+
+// splitFrontMatter separates the front-matter of a template from its body.
+func splitFrontMatter(raw []byte) (FrontMatter, []byte, error) {
+	var fm FrontMatter
+	first, rest, ok := bytes.Cut(raw, []byte("\n"))
+	if !ok || strings.TrimSpace(string(first)) != frontMatterDelim {
+		return fm, raw, nil
+	}
+	for offset := 0; ; {
+		line, next, found := bytes.Cut(rest[offset:], []byte("\n"))
+		if strings.TrimSpace(string(line)) == frontMatterDelim {
+			if err := toml.Unmarshal(rest[:offset], &fm); err != nil {
+				return fm, nil, fmt.Errorf("front-matter: %w", err)
+			}
+			return fm, next, nil
+		}
+		if !found {
+			return fm, nil, fmt.Errorf("front-matter: missing closing %s", frontMatterDelim)
+		}
+		offset += len(line) + 1
+	}
+}
+
+// EvalCondition evaluates a condition pipeline against the template data.
+func EvalCondition(when string, vars TemplateData) (bool, error) {
+	tpl, err := template.New("when").Funcs(templateFuncMap()).Parse("{{if " + when + "}}true{{end}}")
+	if err != nil {
+		return false, err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, vars); err != nil {
+		return false, err
+	}
+	return buf.String() == "true", nil
+}
+
+// matchCondition reports whether a condition path covers the pack file name.
+func matchCondition(pattern, name string) bool {
+	pattern = strings.TrimSuffix(pattern, "/")
+	if name == pattern || strings.HasPrefix(name, pattern+"/") {
+		return true
+	}
+	// Match the pattern against the file and each of its parent directories.
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// included evaluates the pack.toml conditions covering a pack file.
+func included(p Pack, name string, vars TemplateData) (bool, error) {
+	for _, c := range p.Meta.Files {
+		if !matchCondition(c.Path, name) {
+			continue
+		}
+		ok, err := EvalCondition(c.When, vars)
+		if err != nil {
+			return false, &templateError{
+				file: ManifestFile,
+				what: "condition for " + c.Path,
+				err:  fmt.Errorf("condition for %s: %w", c.Path, err),
+			}
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// renderPath renders every segment of a slash-separated path that contains
+// template actions. It returns "" when a segment renders empty, which skips
+// the file.
+func renderPath(rel string, vars TemplateData) (string, error) {
+	if !strings.Contains(rel, "{{") {
+		return rel, nil
+	}
+	segments := strings.Split(rel, "/")
+	for i, seg := range segments {
+		if !strings.Contains(seg, "{{") {
+			continue
+		}
+		out, err := RenderString(seg, vars)
+		if err != nil {
+			return "", fmt.Errorf("path %s: %w", rel, err)
+		}
+		out = strings.TrimSpace(out)
+		if out == "" {
+			return "", nil
+		}
+		if strings.Contains(out, "/") || out == "." || out == ".." {
+			return "", fmt.Errorf("path %s: segment renders to %q", rel, out)
+		}
+		segments[i] = out
+	}
+	return strings.Join(segments, "/"), nil
+}
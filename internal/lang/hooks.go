@@ -0,0 +1,182 @@
+package lang
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"micromanager/internal/config"
+)
+
+// DefaultHookTimeout bounds a hook that does not declare a timeout.
+const DefaultHookTimeout = 5 * time.Minute
+
+// HookOptions configures running post-generate hooks.
+type HookOptions struct {
+	// Skip disables hooks entirely.
+	Skip bool
+	// Stdout and Stderr receive the hook output, os.Stdout and os.Stderr by default.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (o HookOptions) stdout() io.Writer {
+	if o.Stdout != nil {
+		return o.Stdout
+	}
+	return os.Stdout
+}
+
+func (o HookOptions) stderr() io.Writer {
+	if o.Stderr != nil {
+		return o.Stderr
+	}
+	return os.Stderr
+}
+
+// RunHooks runs the post-generate hooks of a pack in order after the given
+// services were generated. Hooks with dir "service" run once per service,
+// hooks with dir "root" (the default) once, rendered for the first service.
+// Arguments and env values are templates rendered with TemplateData.
+// Failing optional hooks only print a warning. Generated files the hooks
+// rewrite, such as go.mod after go mod tidy, take their new hash in the
+// manifest, so that they are not reported as modified.
+func RunHooks(ctx context.Context, root string, p Pack, services []string, opts HookOptions) error {
+	if opts.Skip || len(services) == 0 || len(p.Meta.Hooks.PostGenerate) == 0 {
+		return nil
+	}
+	manifest, err := LoadManifest(root)
+	if err != nil {
+		return err
+	}
+	before := cleanFiles(root, manifest)
+	for _, h := range p.Meta.Hooks.PostGenerate {
+		targets := services[:1]
+		if h.Dir == HookDirService {
+			targets = services
+		}
+		for _, svc := range targets {
+			err := runHook(ctx, root, h, svc, opts)
+			if err == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				// Interrupted: stop, optional hooks included.
+				return fmt.Errorf("hook %s: %w", hookName(h), ctx.Err())
+			}
+			if h.Optional {
+				fmt.Fprintf(opts.stderr(), "warning: optional hook %s failed: %v\n", hookName(h), err)
+				continue
+			}
+			return fmt.Errorf("hook %s: %w", hookName(h), err)
+		}
+	}
+	return rehashRewritten(root, manifest, before)
+}
+
+// cleanFiles returns the content of the generated files that match their
+// manifest hash.
+func cleanFiles(root string, m *Manifest) map[string][]byte {
+	clean := make(map[string][]byte)
+	for _, e := range m.Files {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(e.Path)))
+		if err == nil && HashContent(data) == e.Hash {
+			clean[e.Path] = data
+		}
+	}
+	return clean
+}
+
+// rehashRewritten records the new hash of the clean files that changed since
+// cleanFiles and writes the manifest if any did.
+func rehashRewritten(root string, m *Manifest, before map[string][]byte) error {
+	changed := false
+	for rel, old := range before {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil || bytes.Equal(data, old) {
+			continue
+		}
+		m.Rehash(rel, data)
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	data, err := MarshalManifest(m)
+	if err != nil {
+		return err
+	}
+	return writeContent(ManifestPath(root), data)
+}
+
+func runHook(ctx context.Context, root string, h Hook, serviceName string, opts HookOptions) error {
+	cfg, err := config.LoadServiceConfig(root, serviceName)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	vars := NewTemplateData(root, serviceName, cfg)
+
+	args := make([]string, 0, len(h.Command))
+	for _, arg := range h.Command {
+		rendered, err := RenderString(arg, vars)
+		if err != nil {
+			return fmt.Errorf("render command: %w", err)
+		}
+		args = append(args, rendered)
+	}
+	env := os.Environ()
+	names := make([]string, 0, len(h.Env))
+	for name := range h.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, err := RenderString(h.Env[name], vars)
+		if err != nil {
+			return fmt.Errorf("render env %s: %w", name, err)
+		}
+		env = append(env, name+"="+value)
+	}
+
+	timeout := DefaultHookTimeout
+	if h.Timeout != "" {
+		if timeout, err = time.ParseDuration(h.Timeout); err != nil {
+			return err
+		}
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	dir := root
+	if h.Dir == HookDirService {
+		dir = filepath.Join(root, "services", serviceName)
+	}
+	rel, _ := filepath.Rel(root, dir)
+	fmt.Fprintf(opts.stdout(), "==> %s (in %s)\n", strings.Join(args, " "), filepath.ToSlash(rel))
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = opts.stdout()
+	cmd.Stderr = opts.stderr()
+	err = cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("timed out after %s", timeout)
+	}
+	return err
+}
+
+func hookName(h Hook) string {
+	if h.Name != "" {
+		return h.Name
+	}
+	return strings.Join(h.Command, " ")
+}
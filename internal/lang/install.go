@@ -0,0 +1,480 @@
+package lang
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PackUpgrade describes the outcome of UpgradePack.
+type PackUpgrade struct {
+	ID         string
+	OldVersion string
+	NewVersion string
+	// Files lists the pack files that were added, changed or removed,
+	// relative to the pack directory.
+	Files []Change
+	// UpToDate is set when the source matches the installed pack and
+	// nothing was replaced.
+	UpToDate bool
+}
+
+var packIDRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// InstallPack fetches a pack from a directory, a tarball (.tar, .tar.gz,
+// .tgz, local or http(s)) or a git URL, validates it and its templates as
+// mm packs validate does, and activates it in .mm/packs/<id>. The source and checksum are recorded in .mm/packs.lock.
+func InstallPack(root, source string) (Pack, error) {
+	lock, err := LoadLock(root)
+	if err != nil {
+		return Pack{}, err
+	}
+	staged, cleanup, err := stagePack(root, source)
+	defer cleanup()
+	if err != nil {
+		return Pack{}, err
+	}
+
+	id := staged.Meta.ID
+	if _, ok := lock.Lookup(id); ok {
+		return Pack{}, fmt.Errorf("pack %s is already installed, use mm packs upgrade %s", id, id)
+	}
+	if dir, ok, err := findProjectPack(root, id); err != nil {
+		return Pack{}, err
+	} else if ok {
+		return Pack{}, fmt.Errorf("a pack with id %s already exists in %s", id, dir)
+	}
+	dst := filepath.Join(PacksDir(root), id)
+	if pathExists(dst) {
+		return Pack{}, fmt.Errorf("%s already exists", dst)
+	}
+
+	if err := os.Rename(staged.BaseDir, dst); err != nil {
+		return Pack{}, err
+	}
+	p, err := LoadPack(dst)
+	if err != nil {
+		return Pack{}, err
+	}
+	p.Source = SourceProject
+	checksum, err := TreeChecksum(p.FS)
+	if err != nil {
+		return Pack{}, err
+	}
+	lock.Set(LockEntry{ID: id, Version: p.Meta.Version, Source: normalizeSource(source), Checksum: checksum})
+	return p, SaveLock(root, lock)
+}
+
+// UpgradePack replaces an installed pack with the current content of its
+// source, or of source when it is not empty.
+func UpgradePack(root, id, source string) (PackUpgrade, error) {
+	res := PackUpgrade{ID: id}
+	lock, err := LoadLock(root)
+	if err != nil {
+		return res, err
+	}
+	entry, ok := lock.Lookup(id)
+	if !ok {
+		return res, fmt.Errorf("pack %s was not installed with mm packs install", id)
+	}
+	if source == "" {
+		source = entry.Source
+	}
+	dst := filepath.Join(PacksDir(root), id)
+	current, err := LoadPack(dst)
+	if err != nil {
+		return res, err
+	}
+	res.OldVersion = current.Meta.Version
+
+	staged, cleanup, err := stagePack(root, source)
+	defer cleanup()
+	if err != nil {
+		return res, err
+	}
+	if staged.Meta.ID != id {
+		return res, fmt.Errorf("%s provides pack %s, not %s", source, staged.Meta.ID, id)
+	}
+	res.NewVersion = staged.Meta.Version
+
+	res.Files, err = diffTrees(current.FS, staged.FS)
+	if err != nil {
+		return res, err
+	}
+	checksum, err := TreeChecksum(staged.FS)
+	if err != nil {
+		return res, err
+	}
+	if checksum == entry.Checksum && len(res.Files) == 0 {
+		res.UpToDate = true
+		return res, nil
+	}
+
+	old := filepath.Join(PacksDir(root), ".old-"+id)
+	if err := os.RemoveAll(old); err != nil {
+		return res, err
+	}
+	if err := os.Rename(dst, old); err != nil {
+		return res, err
+	}
+	if err := os.Rename(staged.BaseDir, dst); err != nil {
+		if restoreErr := os.Rename(old, dst); restoreErr != nil {
+			return res, errors.Join(err, restoreErr)
+		}
+		return res, err
+	}
+	if err := os.RemoveAll(old); err != nil {
+		return res, err
+	}
+
+	lock.Set(LockEntry{ID: id, Version: staged.Meta.Version, Source: normalizeSource(source), Checksum: checksum})
+	return res, SaveLock(root, lock)
+}
+
+// RemovePack deletes a pack from .mm/packs and the lock file.
+func RemovePack(root, id string) error {
+	lock, err := LoadLock(root)
+	if err != nil {
+		return err
+	}
+	_, locked := lock.Lookup(id)
+	dir, found, err := findProjectPack(root, id)
+	if err != nil {
+		return err
+	}
+	if !locked && !found {
+		return fmt.Errorf("pack %s is not installed in %s", id, PacksDir(root))
+	}
+	if found {
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	lock.Remove(id)
+	return SaveLock(root, lock)
+}
+
+// ServicesUsingPack lists the services whose generated files were last
+// rendered by the pack, according to the manifest.
+func ServicesUsingPack(root, id string) ([]string, error) {
+	m, err := LoadManifest(root)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var services []string
+	for _, e := range m.Files {
+		if e.Pack == id && !seen[e.Service] {
+			seen[e.Service] = true
+			services = append(services, e.Service)
+		}
+	}
+	sort.Strings(services)
+	return services, nil
+}
+
+// findProjectPack returns the directory of the project pack with the given ID.
+func findProjectPack(root, id string) (string, bool, error) {
+	dirs, err := PackDirs(PacksDir(root))
+	if err != nil {
+		return "", false, err
+	}
+	for _, dir := range dirs {
+		if p, err := LoadPack(dir); err == nil && p.Meta.ID == id {
+			return dir, true, nil
+		}
+	}
+	dir := filepath.Join(PacksDir(root), id)
+	return dir, pathExists(dir), nil
+}
+
+// stagePack fetches source into a staging directory next to .mm/packs, so
+// that activating it is a rename, and validates it. cleanup removes
+// whatever was not activated.
+func stagePack(root, source string) (Pack, func(), error) {
+	tmp, err := os.MkdirTemp("", "mm-pack-")
+	if err != nil {
+		return Pack{}, func() {}, err
+	}
+	if err := os.MkdirAll(PacksDir(root), 0o755); err != nil {
+		os.RemoveAll(tmp)
+		return Pack{}, func() {}, err
+	}
+	staging, err := os.MkdirTemp(PacksDir(root), ".staging-")
+	if err != nil {
+		os.RemoveAll(tmp)
+		return Pack{}, func() {}, err
+	}
+	cleanup := func() {
+		os.RemoveAll(tmp)
+		os.RemoveAll(staging)
+	}
+
+	if err := fetchPack(source, tmp); err != nil {
+		return Pack{}, cleanup, fmt.Errorf("fetch %s: %w", source, err)
+	}
+	src, err := packRoot(tmp)
+	if err != nil {
+		return Pack{}, cleanup, fmt.Errorf("%s: %w", source, err)
+	}
+	dst := filepath.Join(staging, "pack")
+	if err := copyTree(src, dst); err != nil {
+		return Pack{}, cleanup, err
+	}
+
+	p, err := LoadPack(dst)
+	if err != nil {
+		return Pack{}, cleanup, err
+	}
+	if !packIDRe.MatchString(p.Meta.ID) {
+		return Pack{}, cleanup, fmt.Errorf("pack id %q cannot be used as a directory name", p.Meta.ID)
+	}
+	resolved, err := ResolvePack(root, p)
+	if err == nil {
+		err = Validate(resolved)
+	}
+	if err == nil {
+		err = problemsError(CheckTemplates(resolved))
+	}
+	if err != nil {
+		return Pack{}, cleanup, fmt.Errorf("pack %s is invalid:\n%w", p.Meta.ID, err)
+	}
+	return p, cleanup, nil
+}
+
+// fetchPack copies, extracts or clones source into dst.
+func fetchPack(source, dst string) error {
+	switch {
+	case isTarball(source):
+		return fetchTarball(source, dst)
+	case isGitSource(source):
+		return cloneGit(source, dst)
+	default:
+		info, err := os.Stat(source)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("not a directory, tarball or git repository")
+		}
+		return copyTree(source, dst)
+	}
+}
+
+func isTarball(source string) bool {
+	for _, ext := range []string{".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(source, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// isGitSource reports whether source names a git repository: a git URL, a
+// path ending in .git or a local bare repository.
+func isGitSource(source string) bool {
+	url, _, _ := strings.Cut(source, "#")
+	for _, prefix := range []string{"git+", "git@", "git://", "ssh://", "file://", "http://", "https://"} {
+		if strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	if strings.HasSuffix(url, ".git") {
+		return true
+	}
+	// A bare repository has HEAD and objects/ at its top level.
+	return pathExists(filepath.Join(url, "HEAD")) && pathExists(filepath.Join(url, "objects"))
+}
+
+// cloneGit clones a repository. A "#ref" suffix selects a branch or tag.
+func cloneGit(source, dst string) error {
+	url, ref, _ := strings.Cut(strings.TrimPrefix(source, "git+"), "#")
+	args := []string{"clone", "--quiet"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, url, dst)
+	cmd := exec.Command("git", args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("git clone: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return os.RemoveAll(filepath.Join(dst, ".git"))
+}
+
+func fetchTarball(source, dst string) error {
+	var r io.Reader
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		resp, err := http.Get(source)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("download: %s", resp.Status)
+		}
+		r = resp.Body
+	} else {
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if !strings.HasSuffix(source, ".tar") {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return extractTar(r, dst)
+}
+
+// extractTar writes directories and regular files from a tar stream into
+// dst, rejecting entries that would escape it.
+func extractTar(r io.Reader, dst string) error {
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("tarball entry %s escapes the pack directory", hdr.Name)
+		}
+		target := filepath.Join(dst, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+				return err
+			}
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// packRoot returns dir if it holds a pack manifest, or its only
+// subdirectory if that one does, as is common for tarballs.
+func packRoot(dir string) (string, error) {
+	hasManifest := func(d string) bool {
+		return pathExists(filepath.Join(d, ManifestFile)) || pathExists(filepath.Join(d, LegacyManifestFile))
+	}
+	if hasManifest(dir) {
+		return dir, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 1 && entries[0].IsDir() {
+		sub := filepath.Join(dir, entries[0].Name())
+		if hasManifest(sub) {
+			return sub, nil
+		}
+	}
+	return "", fmt.Errorf("no %s found", ManifestFile)
+}
+
+// copyTree copies the files under src to dst, leaving out .git.
+func copyTree(src, dst string) error {
+	return filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return os.MkdirAll(filepath.Join(dst, rel), 0o755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(filepath.Join(dst, rel), data, 0o644)
+	})
+}
+
+// diffTrees lists the files added, changed or removed between two packs.
+func diffTrees(oldFS, newFS fs.FS) ([]Change, error) {
+	oldHashes, err := TreeHashes(oldFS)
+	if err != nil {
+		return nil, err
+	}
+	newHashes, err := TreeHashes(newFS)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	for p, h := range newHashes {
+		old, ok := oldHashes[p]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Path: p, Kind: ChangeCreated})
+		case old != h:
+			changes = append(changes, Change{Path: p, Kind: ChangeModified})
+		}
+	}
+	for p := range oldHashes {
+		if _, ok := newHashes[p]; !ok {
+			changes = append(changes, Change{Path: p, Kind: ChangeDeleted})
+		}
+	}
+	SortChanges(changes)
+	return changes, nil
+}
+
+// normalizeSource makes local paths absolute so that upgrades work from any
+// directory.
+func normalizeSource(source string) string {
+	url, ref, hasRef := strings.Cut(source, "#")
+	if strings.Contains(url, "://") || strings.HasPrefix(url, "git@") || strings.HasPrefix(url, "git+") {
+		return source
+	}
+	abs, err := filepath.Abs(url)
+	if err != nil {
+		return source
+	}
+	if hasRef {
+		return abs + "#" + ref
+	}
+	return abs
+}
@@ -0,0 +1,168 @@
+package lang
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// demoPack holds the files of a small valid pack.
+var demoPack = map[string]string{
+	"pack.toml": `id = "demo"
+lang = "go"
+version = "0.1.0"
+`,
+	"templates/service/main.go.tmpl": "package main\n\n// {{.ServiceName}} says hello.\nfunc main() {}\n",
+	"templates/service/README.md":    "# {{.ServiceName}}\n",
+}
+
+// newProject returns an empty project root, isolated from the user's packs.
+func newProject(t *testing.T) string {
+	t.Helper()
+	t.Setenv("MM_PACKS_DIR", t.TempDir())
+	return t.TempDir()
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// writeTarball writes files to a .tar.gz under a top-level directory.
+func writeTarball(t *testing.T, files map[string]string) string {
+	t.Helper()
+	name := filepath.Join(t.TempDir(), "demo-0.1.0.tar.gz")
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	for path, content := range files {
+		hdr := &tar.Header{Name: "demo-0.1.0/" + path, Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return name
+}
+
+// git runs git in dir.
+func git(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=mm", "-c", "user.email=mm@example.com"}, args...)...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+}
+
+// checkInstalled checks that the demo pack is active and locked to source.
+func checkInstalled(t *testing.T, root string, p Pack, source string) {
+	t.Helper()
+	if p.Meta.ID != "demo" || p.Source != SourceProject {
+		t.Fatalf("installed %s from %s", p.Meta.ID, p.Source)
+	}
+	if _, err := os.Stat(filepath.Join(PacksDir(root), "demo", "templates", "service", "main.go.tmpl")); err != nil {
+		t.Fatal(err)
+	}
+	lock, err := LoadLock(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, ok := lock.Lookup("demo")
+	if !ok {
+		t.Fatal("demo not in packs.lock")
+	}
+	if entry.Source != source || entry.Version != "0.1.0" || entry.Checksum == "" {
+		t.Errorf("lock entry = %+v", entry)
+	}
+}
+
+func TestInstallPackFromBareRepository(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := newProject(t)
+	work := t.TempDir()
+	writeFiles(t, work, demoPack)
+	git(t, work, "init", "--quiet")
+	git(t, work, "add", ".")
+	git(t, work, "commit", "--quiet", "-m", "demo pack")
+	// No .git suffix: the repository is recognized by its layout.
+	bare := filepath.Join(t.TempDir(), "demo")
+	git(t, work, "clone", "--quiet", "--bare", work, bare)
+
+	p, err := InstallPack(root, bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInstalled(t, root, p, bare)
+	if _, err := os.Stat(filepath.Join(PacksDir(root), "demo", ".git")); !os.IsNotExist(err) {
+		t.Errorf(".git was installed: %v", err)
+	}
+}
+
+func TestInstallPackFromTarball(t *testing.T) {
+	root := newProject(t)
+	tarball := writeTarball(t, demoPack)
+
+	p, err := InstallPack(root, tarball)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInstalled(t, root, p, tarball)
+
+	if _, err := InstallPack(root, tarball); err == nil || !strings.Contains(err.Error(), "already installed") {
+		t.Errorf("second install: %v", err)
+	}
+}
+
+func TestInstallPackChecksTemplates(t *testing.T) {
+	root := newProject(t)
+	files := map[string]string{}
+	for name, content := range demoPack {
+		files[name] = content
+	}
+	files["templates/service/broken.go.tmpl"] = "package main\n\n{{.Nope}}\n"
+	tarball := writeTarball(t, files)
+
+	_, err := InstallPack(root, tarball)
+	if err == nil || !strings.Contains(err.Error(), "templates/service/broken.go.tmpl:3") {
+		t.Fatalf("InstallPack error = %v, want the broken template", err)
+	}
+	entries, err := os.ReadDir(PacksDir(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("%s holds %d entries after a failed install", PacksDir(root), len(entries))
+	}
+	if lock, err := LoadLock(root); err != nil {
+		t.Fatal(err)
+	} else if _, ok := lock.Lookup("demo"); ok {
+		t.Error("demo locked after a failed install")
+	}
+}
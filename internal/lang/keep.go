@@ -0,0 +1,152 @@
+package lang
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// KeepBlock is a region of a generated file owned by the user. It lies
+// between a "mm:keep begin <id>" and a "mm:keep end" line, written in the
+// comment syntax of the file:
+//
+//	// mm:keep begin validators
+//	v.RegisterValidation("sku", validateSKU)
+//	// mm:keep end
+//
+// When a file is regenerated, the body of every block is carried over from
+// the existing file into the block with the same ID.
+type KeepBlock struct {
+	ID string
+	// Line is the line of the begin marker.
+	Line int
+	Body []byte
+
+	// start and end are the offsets of Body in the file.
+	start, end int
+}
+
+// OrphanBlock is a keep-block of an existing file that is missing from the
+// regenerated file, so its body was not carried over.
+type OrphanBlock struct {
+	Path string
+	KeepBlock
+}
+
+func (o OrphanBlock) String() string {
+	return fmt.Sprintf("%s:%d: keep-block %q has no place in the regenerated file", o.Path, o.Line, o.ID)
+}
+
+// Markers stand on their own line, surrounded only by comment punctuation
+// such as //, #, -- or <!-- -->.
+var (
+	keepBeginRe = regexp.MustCompile(`(?m)^[ \t]*[^\w\s]*[ \t]*mm:keep begin[ \t]+([\w.-]+)[ \t]*[^\w\s]*[ \t]*\r?$`)
+	keepEndRe   = regexp.MustCompile(`(?m)^[ \t]*[^\w\s]*[ \t]*mm:keep end[ \t]*[^\w\s]*[ \t]*\r?$`)
+)
+
+// ParseKeepBlocks returns the keep-blocks of a file in order. Blocks may not
+// nest and IDs must be unique within a file.
+func ParseKeepBlocks(content []byte) ([]KeepBlock, error) {
+	var blocks []KeepBlock
+	var open *KeepBlock
+	ids := make(map[string]bool)
+	for offset, line := 0, 1; offset < len(content); line++ {
+		text, _, found := bytes.Cut(content[offset:], []byte("\n"))
+		next := offset + len(text)
+		if found {
+			next++
+		}
+		if m := keepBeginRe.FindSubmatch(text); m != nil {
+			id := string(m[1])
+			switch {
+			case open != nil:
+				return nil, fmt.Errorf("line %d: keep-block %q begins inside %q", line, id, open.ID)
+			case ids[id]:
+				return nil, fmt.Errorf("line %d: duplicate keep-block %q", line, id)
+			}
+			ids[id] = true
+			open = &KeepBlock{ID: id, Line: line, start: next}
+		} else if keepEndRe.Match(text) {
+			if open == nil {
+				return nil, fmt.Errorf("line %d: mm:keep end without begin", line)
+			}
+			open.end = offset
+			open.Body = content[open.start:open.end]
+			blocks = append(blocks, *open)
+			open = nil
+		}
+		offset = next
+	}
+	if open != nil {
+		return nil, fmt.Errorf("line %d: keep-block %q is not closed", open.Line, open.ID)
+	}
+	return blocks, nil
+}
+
+// ApplyKeepBlocks replaces the body of every keep-block in rendered with the
+// body of the block with the same ID in existing.
+func ApplyKeepBlocks(rendered, existing []byte) ([]byte, error) {
+	kept, err := ParseKeepBlocks(existing)
+	if err != nil || len(kept) == 0 {
+		return rendered, err
+	}
+	blocks, err := ParseKeepBlocks(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("rendered file: %w", err)
+	}
+	bodies := make(map[string][]byte, len(kept))
+	for _, b := range kept {
+		bodies[b.ID] = b.Body
+	}
+
+	var out bytes.Buffer
+	last := 0
+	for _, b := range blocks {
+		body, ok := bodies[b.ID]
+		if !ok {
+			continue
+		}
+		out.Write(rendered[last:b.start])
+		out.Write(body)
+		last = b.end
+	}
+	out.Write(rendered[last:])
+	return out.Bytes(), nil
+}
+
+// MissingKeepBlocks returns the keep-blocks of old whose ID does not occur in
+// updated. Files with malformed markers have no blocks.
+func MissingKeepBlocks(path string, old, updated []byte) []OrphanBlock {
+	blocks, _ := ParseKeepBlocks(old)
+	if len(blocks) == 0 {
+		return nil
+	}
+	present := make(map[string]bool)
+	for _, m := range keepBeginRe.FindAllSubmatch(updated, -1) {
+		present[string(m[1])] = true
+	}
+	var orphans []OrphanBlock
+	for _, b := range blocks {
+		if !present[b.ID] {
+			orphans = append(orphans, OrphanBlock{Path: path, KeepBlock: b})
+		}
+	}
+	return orphans
+}
+
+// stripKeepBlocks empties the body of every keep-block, so that content
+// hashes do not change when users edit inside them.
+func stripKeepBlocks(content []byte) []byte {
+	blocks, err := ParseKeepBlocks(content)
+	if err != nil || len(blocks) == 0 {
+		return content
+	}
+	var out bytes.Buffer
+	last := 0
+	for _, b := range blocks {
+		out.Write(content[last:b.start])
+		last = b.end
+	}
+	out.Write(content[last:])
+	return out.Bytes()
+}
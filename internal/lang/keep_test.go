@@ -0,0 +1,185 @@
+package lang
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseKeepBlocks(t *testing.T) {
+	type block struct {
+		id   string
+		line int
+		body string
+	}
+	tests := []struct {
+		name    string
+		content string
+		want    []block
+		err     string
+	}{
+		{
+			name:    "go comments",
+			content: "package std\n\n\t// mm:keep begin validators\n\tv.Register()\n\t// mm:keep end\n",
+			want:    []block{{"validators", 3, "\tv.Register()\n"}},
+		},
+		{
+			name:    "hash comments",
+			content: "[env]\n# mm:keep begin extra-vars\nFOO = 1\nBAR = 2\n#mm:keep end\n",
+			want:    []block{{"extra-vars", 2, "FOO = 1\nBAR = 2\n"}},
+		},
+		{
+			name:    "html comments",
+			content: "# Title\n<!-- mm:keep begin notes -->\nmine\n<!-- mm:keep end -->\n<!-- mm:keep begin empty.v2 -->\n<!-- mm:keep end -->\n",
+			want:    []block{{"notes", 2, "mine\n"}, {"empty.v2", 5, ""}},
+		},
+		{
+			name:    "crlf",
+			content: "a\r\n// mm:keep begin x\r\nbody\r\n// mm:keep end\r\nb\r\n",
+			want:    []block{{"x", 2, "body\r\n"}},
+		},
+		{
+			name:    "last line without newline",
+			content: "// mm:keep begin x\nbody\n// mm:keep end",
+			want:    []block{{"x", 1, "body\n"}},
+		},
+		{
+			name:    "marker inside code is not a marker",
+			content: "s := \"mm:keep begin x\"\n",
+		},
+		{
+			name:    "nested",
+			content: "// mm:keep begin a\n// mm:keep begin b\n// mm:keep end\n// mm:keep end\n",
+			err:     `line 2: keep-block "b" begins inside "a"`,
+		},
+		{
+			name:    "duplicate",
+			content: "// mm:keep begin a\n// mm:keep end\n// mm:keep begin a\n// mm:keep end\n",
+			err:     `line 3: duplicate keep-block "a"`,
+		},
+		{
+			name:    "unclosed",
+			content: "x\n// mm:keep begin a\nbody\n",
+			err:     `line 2: keep-block "a" is not closed`,
+		},
+		{
+			name:    "end without begin",
+			content: "x\n// mm:keep end\n",
+			err:     "line 2: mm:keep end without begin",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			blocks, err := ParseKeepBlocks([]byte(tt.content))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []block
+			for _, b := range blocks {
+				got = append(got, block{b.ID, b.Line, string(b.Body)})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("blocks = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestApplyKeepBlocks(t *testing.T) {
+	tests := []struct {
+		name               string
+		rendered, existing string
+		want               string
+		err                string
+	}{
+		{
+			name:     "body carried over",
+			rendered: "func f() {\n\t// mm:keep begin f\n\treturn nil\n\t// mm:keep end\n}\n",
+			existing: "func f() {\n\t// mm:keep begin f\n\treturn mine()\n\t// mm:keep end\n}\n",
+			want:     "func f() {\n\t// mm:keep begin f\n\treturn mine()\n\t// mm:keep end\n}\n",
+		},
+		{
+			name:     "block moved",
+			rendered: "# B\n# mm:keep begin b\n# mm:keep end\n# A\n# mm:keep begin a\n# mm:keep end\n",
+			existing: "# mm:keep begin a\nalpha\n# mm:keep end\n# mm:keep begin b\nbeta\n# mm:keep end\n",
+			want:     "# B\n# mm:keep begin b\nbeta\n# mm:keep end\n# A\n# mm:keep begin a\nalpha\n# mm:keep end\n",
+		},
+		{
+			name:     "new block keeps the rendered body",
+			rendered: "<!-- mm:keep begin a -->\ndefault\n<!-- mm:keep end -->\n",
+			existing: "nothing kept\n",
+			want:     "<!-- mm:keep begin a -->\ndefault\n<!-- mm:keep end -->\n",
+		},
+		{
+			name:     "crlf",
+			rendered: "x\r\n// mm:keep begin a\r\n// mm:keep end\r\n",
+			existing: "// mm:keep begin a\r\nmine\r\n// mm:keep end\r\n",
+			want:     "x\r\n// mm:keep begin a\r\nmine\r\n// mm:keep end\r\n",
+		},
+		{
+			name:     "malformed existing file",
+			rendered: "// mm:keep begin a\n// mm:keep end\n",
+			existing: "// mm:keep begin a\n",
+			err:      `line 1: keep-block "a" is not closed`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ApplyKeepBlocks([]byte(tt.rendered), []byte(tt.existing))
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got:\n%q\nwant:\n%q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMissingKeepBlocks(t *testing.T) {
+	old := "// mm:keep begin kept\nx\n// mm:keep end\n\n// mm:keep begin dropped\ny\n// mm:keep end\n"
+	updated := "// mm:keep begin kept\n// mm:keep end\n"
+	orphans := MissingKeepBlocks("core/service.go", []byte(old), []byte(updated))
+	if len(orphans) != 1 {
+		t.Fatalf("orphans = %v", orphans)
+	}
+	o := orphans[0]
+	if o.ID != "dropped" || o.Line != 5 || string(o.Body) != "y\n" {
+		t.Errorf("orphan = %+v", o)
+	}
+	if got := o.String(); !strings.HasPrefix(got, `core/service.go:5: keep-block "dropped"`) {
+		t.Errorf("String = %q", got)
+	}
+
+	// The body of an orphaned block is not carried over.
+	merged, err := ApplyKeepBlocks([]byte(updated), []byte(old))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(merged), "y\n") {
+		t.Errorf("orphaned body carried over:\n%s", merged)
+	}
+}
+
+func TestHashContentIgnoresKeepBlockBodies(t *testing.T) {
+	a := "a\n// mm:keep begin x\none\n// mm:keep end\n"
+	b := "a\n// mm:keep begin x\ntwo\nlines\n// mm:keep end\n"
+	if HashContent([]byte(a)) != HashContent([]byte(b)) {
+		t.Error("hash depends on a keep-block body")
+	}
+	if HashContent([]byte(a)) == HashContent([]byte("b"+a[1:])) {
+		t.Error("hash ignores content outside keep-blocks")
+	}
+}
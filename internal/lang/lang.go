@@ -2,211 +2,525 @@ package lang
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"io"
+	"go/format"
+	"io/fs"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 	"text/template"
 	"unicode"
 
-	toml "github.com/pelletier/go-toml/v2"
+	"micromanager/internal/config"
 )
 
-// Metadata describes a language pack as defined in language.toml.
+// Metadata describes a language pack as defined in pack.toml. See the
+// "Pack manifest" section of the README for the documented schema.
 type Metadata struct {
 	ID          string `toml:"id"`
 	Name        string `toml:"name"`
 	Lang        string `toml:"lang"`
 	Version     string `toml:"version"`
 	Description string `toml:"description,omitempty"`
+	// Extends names a parent pack whose templates and variables this pack
+	// overlays.
+	Extends string `toml:"extends,omitempty"`
+	// Files holds conditions for rendering files and directories.
+	Files []FileCondition `toml:"files,omitempty"`
+	// MMVersion is a version constraint mm must satisfy, e.g. ">=0.1.0".
+	MMVersion string `toml:"mm_version,omitempty"`
+	// ServiceTypes lists the kinds of service the pack generates; the first
+	// one is the default. Each type adds templates/service/<name>/ to the
+	// shared service templates.
+	ServiceTypes []ServiceType `toml:"service_types,omitempty"`
+	Variables    []Variable    `toml:"variables,omitempty"`
+	Requires     []Requirement `toml:"requires,omitempty"`
+	Hooks        Hooks         `toml:"hooks,omitempty"`
+	Test         TestConfig    `toml:"test,omitempty"`
 }
 
+// TestConfig describes how services generated by a pack are tested.
+type TestConfig struct {
+	// Command is run from the repo root; every argument is a template
+	// rendered with TemplateData.
+	Command []string `toml:"command"`
+	// Format selects how output is parsed: "go-test-json" yields per-test
+	// counts, anything else only the exit status.
+	Format string `toml:"format,omitempty"`
+}
+
+// ServiceType describes a kind of service a pack generates, such as an HTTP
+// server or a background worker. In pack.toml it is either a table or, in
+// older packs, just the name.
+type ServiceType struct {
+	Name        string `toml:"name"`
+	Description string `toml:"description,omitempty"`
+	// Build is the package mm run builds, relative to the service
+	// directory, e.g. "./server". When empty, ./server is built if it
+	// exists and the service directory otherwise.
+	Build string `toml:"build,omitempty"`
+	// Ready tells when a running service counts as started: ReadyPort
+	// (the default) once it accepts connections on its port, ReadyStarted
+	// as soon as the process runs.
+	Ready string `toml:"ready,omitempty"`
+	// Health is an HTTP path, such as "/", of services that listen. When
+	// set, a service is ready once a GET on it answers without a server
+	// error.
+	Health string `toml:"health,omitempty"`
+	// Test replaces the pack's [test] for services of this type.
+	Test TestConfig `toml:"test,omitempty"`
+}
+
+// Values of ServiceType.Ready.
+const (
+	ReadyPort    = "port"
+	ReadyStarted = "started"
+)
+
+// UnmarshalText reads a service type given only by name.
+func (t *ServiceType) UnmarshalText(text []byte) error {
+	*t = ServiceType{Name: string(text)}
+	return nil
+}
+
+// Listens reports whether services of the type serve on a port.
+func (t ServiceType) Listens() bool {
+	return t.Ready != ReadyStarted
+}
+
+// TestFormatGoJSON is the TestConfig.Format of `go test -json` output.
+const TestFormatGoJSON = "go-test-json"
+
 // Pack represents a loaded language pack.
 type Pack struct {
-	Meta    Metadata
-	BaseDir string // directory containing language.toml and templates
+	Meta Metadata
+	// FS holds pack.toml and templates/.
+	FS fs.FS
+	// BaseDir is the pack directory on disk, empty for built-in packs.
+	BaseDir string
+	// Source tells where the pack was found: SourceProject, SourceUser or SourceBuiltin.
+	Source string
 }
 
 // TemplateData is passed into templates during rendering.
 type TemplateData struct {
-	ProjectName string
-	ServiceName string
+	ProjectName string `toml:"project_name"`
+	ServiceName string `toml:"service_name"`
+	Database    string `toml:"database,omitempty"`
+	// Type is the service type. Render sets it to the pack's default type
+	// when empty.
+	Type string `toml:"type,omitempty"`
+	// Vars holds pack variables by name. Render fills in declared defaults
+	// and converts values to their declared types.
+	Vars map[string]any `toml:"vars,omitempty"`
+	// API is the API definition of the service, see LoadTemplateData. It is
+	// read from the service on every render rather than recorded.
+	API *APIData `toml:"-"`
+}
+
+// File is a single rendered template output.
+type File struct {
+	Path     string // slash-separated path relative to the repo root
+	Template string // slash-separated path relative to the pack templates directory
+	Content  []byte
 }
 
-// PacksDir returns the default packs directory under the repo root.
-func PacksDir(root string) string {
-	return filepath.Join(root, ".mm", "packs")
+// GeneratedDir returns the directory holding the last generated version of
+// every file, used as the common ancestor when services are updated.
+func GeneratedDir(root string) string {
+	return filepath.Join(root, ".mm", "generated")
 }
 
-// LoadAll scans the packs directory for language.toml files and loads packs.
-func LoadAll(root string) ([]Pack, error) {
-	base := PacksDir(root)
-	entries, err := os.ReadDir(base)
+// LoadGenerated returns the last generated content recorded for a repo-relative path.
+func LoadGenerated(root, relPath string) ([]byte, bool) {
+	data, err := os.ReadFile(filepath.Join(GeneratedDir(root), filepath.FromSlash(relPath)))
+	if err != nil {
+		return nil, false
+	}
+	return data, true
+}
+
+// ServiceConfigPath returns the repo-relative path of a service's service.toml.
+// The pack's rendered service.toml only contributes environment defaults and
+// is merged into the existing config instead of overwriting it.
+func ServiceConfigPath(serviceName string) string {
+	return path.Join("services", serviceName, "service.toml")
+}
+
+// Render renders the pack templates for a service into memory using generic rules:
+// - templates/service/*             => services/<serviceName>/ (except other types' directories)
+// - templates/service/<type>/*      => services/<serviceName>/ (replacing shared files)
+// - templates/database/<database>/* => services/<serviceName>/ (when a database is set)
+// - templates/common/*              => common/
+// - templates/root/*                => repo root
+// Without vars.API, templates see the API declared by the pack's default
+// api.toml for the service type.
+func Render(p Pack, vars TemplateData) ([]File, error) {
+	files, err := render(p, vars)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, nil
-		}
 		return nil, err
 	}
-	var packs []Pack
-	for _, e := range entries {
-		if !e.IsDir() {
-			continue
-		}
-		packDir := filepath.Join(base, e.Name())
-		metaPath := filepath.Join(packDir, "language.toml")
-		data, err := os.ReadFile(metaPath)
-		if err != nil {
-			// skip invalid pack folder
-			continue
+	return files, nil
+}
+
+// render is Render, except that a failing template does not stop the
+// others: the files that rendered are returned along with the errors of
+// the others, joined.
+func render(p Pack, vars TemplateData) ([]File, error) {
+	serviceName := vars.ServiceName
+
+	if !fsExists(p.FS, "templates/service") {
+		return nil, fmt.Errorf("pack %s missing templates/service", p.Meta.ID)
+	}
+	if vars.Database != "" && !SupportsDatabase(p, vars.Database) {
+		return nil, fmt.Errorf("pack %s does not support database %q", p.Meta.ID, vars.Database)
+	}
+	st, err := FindServiceType(p, vars.Type)
+	if err != nil {
+		return nil, err
+	}
+	vars.Type = st.Name
+	resolved, err := ResolveVars(p, vars.Vars)
+	if err != nil {
+		return nil, err
+	}
+	vars.Vars = resolved
+	if vars.API == nil {
+		if vars.API, err = defaultAPI(p, vars); err != nil {
+			return nil, err
 		}
-		var m Metadata
-		if err := toml.Unmarshal(data, &m); err != nil {
+	}
+
+	serviceDst := path.Join("services", serviceName)
+	trees := []templateTree{{src: "service", dst: serviceDst}}
+	for _, t := range p.Meta.ServiceTypes {
+		trees[0].skip = append(trees[0].skip, path.Join("templates", "service", t.Name))
+	}
+	if st.Name != "" {
+		trees = append(trees, templateTree{src: path.Join("service", st.Name), dst: serviceDst})
+	}
+	if vars.Database != "" {
+		trees = append(trees, templateTree{src: path.Join("database", vars.Database), dst: serviceDst})
+	}
+	trees = append(trees,
+		templateTree{src: "common", dst: "common"},
+		templateTree{src: "root", dst: ""},
+	)
+
+	var files []File
+	var errs []error
+	for _, tree := range trees {
+		if !fsExists(p.FS, path.Join("templates", tree.src)) {
 			continue
 		}
-		p := Pack{Meta: m, BaseDir: packDir}
-		if err := Validate(p); err != nil {
-			// skip invalid packs
-			continue
+		rendered, err := renderTemplateTree(p, tree, vars)
+		if err != nil {
+			errs = append(errs, err)
 		}
-		packs = append(packs, p)
+		files = append(files, rendered...)
 	}
-	return packs, nil
+	return dedupeFiles(files), errors.Join(errs...)
 }
 
-// Validate ensures required metadata and template paths exist.
-func Validate(p Pack) error {
-	if strings.TrimSpace(p.Meta.ID) == "" {
-		return fmt.Errorf("pack missing id")
-	}
-	if strings.TrimSpace(p.Meta.Lang) == "" {
-		return fmt.Errorf("pack missing lang")
+// templateTree maps a directory under templates/ to its destination in the repo.
+type templateTree struct {
+	src string
+	dst string
+	// skip holds pack paths of directories left out of the tree.
+	skip []string
+}
+
+// dedupeFiles drops files rendered to the same path as a later file, so
+// that type templates replace the shared ones. The order is kept otherwise.
+func dedupeFiles(files []File) []File {
+	last := make(map[string]int, len(files))
+	for i, f := range files {
+		last[f.Path] = i
 	}
-	// Require templates/service directory for service scaffolding
-	serviceTpl := filepath.Join(p.BaseDir, "templates", "service")
-	info, err := os.Stat(serviceTpl)
-	if err != nil || !info.IsDir() {
-		return fmt.Errorf("pack %s missing templates/service", p.Meta.ID)
+	out := files[:0]
+	for i, f := range files {
+		if last[f.Path] == i {
+			out = append(out, f)
+		}
 	}
-	return nil
+	return out
 }
 
-// FindByLang returns the first pack matching a given language.
-func FindByLang(root, lang string) (*Pack, error) {
-	packs, err := LoadAll(root)
-	if err != nil {
-		return nil, err
+// FindServiceType returns the pack's service type with the given name, or
+// its default type when name is empty. Packs that declare no types only
+// accept the empty name and yield a zero ServiceType.
+func FindServiceType(p Pack, name string) (ServiceType, error) {
+	types := p.Meta.ServiceTypes
+	if name == "" {
+		if len(types) == 0 {
+			return ServiceType{}, nil
+		}
+		return types[0], nil
 	}
-	for _, p := range packs {
-		if strings.EqualFold(p.Meta.Lang, lang) {
-			pp := p
-			return &pp, nil
+	for _, t := range types {
+		if t.Name == name {
+			return t, nil
 		}
 	}
+	if len(types) == 0 {
+		return ServiceType{}, fmt.Errorf("pack %s declares no service types, cannot use %q", p.Meta.ID, name)
+	}
+	return ServiceType{}, fmt.Errorf("pack %s has no service type %q (supported: %s)",
+		p.Meta.ID, name, strings.Join(ServiceTypeNames(p), ", "))
+}
 
-	// Fallback to local pack directory (pack/lang/<lang>) if .mm/packs has none.
-	if p, err := findLocalPack(root, lang); err != nil {
-		return nil, err
-	} else if p != nil {
-		return p, nil
+// ServiceTypeNames lists the names of the pack's service types.
+func ServiceTypeNames(p Pack) []string {
+	names := make([]string, 0, len(p.Meta.ServiceTypes))
+	for _, t := range p.Meta.ServiceTypes {
+		names = append(names, t.Name)
 	}
-	return nil, nil
+	return names
 }
 
-// ApplyService copies pack templates into the repository using generic rules:
-// - templates/service/* => services/<serviceName>/
-// - templates/common/*  => services/common/ (full overwrite)
-// - templates/root/*    => repo root
-// After copy, go mod tidy is executed to produce go.sum.
-func ApplyService(root string, p Pack, serviceName string) error {
-	base := filepath.Join(p.BaseDir, "templates")
-	vars := TemplateData{
+// NewTemplateData returns the template data for a service in the repository.
+func NewTemplateData(root, serviceName string, cfg config.ServiceConfig) TemplateData {
+	return TemplateData{
 		ProjectName: detectProjectName(root),
 		ServiceName: serviceName,
+		Database:    cfg.General.Database,
+		Type:        cfg.General.Type,
+		Vars:        cfg.Vars,
 	}
+}
+
+// SupportsDatabase reports whether the pack ships templates/database/<database>.
+func SupportsDatabase(p Pack, database string) bool {
+	return database != "" && fsExists(p.FS, path.Join("templates", "database", database))
+}
 
-	serviceSrc := filepath.Join(base, "service")
-	if !pathExists(serviceSrc) {
-		return fmt.Errorf("pack %s missing templates/service", p.Meta.ID)
+// Databases lists the databases the pack ships templates for.
+func Databases(p Pack) []string {
+	entries, err := fs.ReadDir(p.FS, "templates/database")
+	if err != nil {
+		return nil
 	}
-	serviceDst := filepath.Join(root, "services", serviceName)
-	if err := copyTemplateTree(serviceSrc, serviceDst, vars, true); err != nil {
-		return err
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
+		}
 	}
+	return names
+}
 
-	commonSrc := filepath.Join(base, "common")
-	if pathExists(commonSrc) {
-		commonDst := filepath.Join(root, "common")
-		if err := os.RemoveAll(commonDst); err != nil {
-			return err
-		}
-		if err := copyTemplateTree(commonSrc, commonDst, vars, true); err != nil {
-			return err
-		}
+// StageService renders a service with cfg and stages the result in t.
+// common/ is replaced as a whole and service.toml only gains the pack's
+// environment defaults. Keep-blocks of existing files are carried over; the
+// ones that could not be are returned. Every file is recorded under
+// .mm/generated and in the manifest so that later updates can merge against
+// it and drift can be detected. Nothing is written before t is committed.
+func StageService(t *Txn, p Pack, serviceName string, cfg config.ServiceConfig) ([]OrphanBlock, error) {
+	root := t.Root()
+	vars, err := LoadTemplateData(root, serviceName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	files, err := Render(p, vars)
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := LoadManifest(root)
+	if err != nil {
+		return nil, err
 	}
 
-	rootSrc := filepath.Join(base, "root")
-	if pathExists(rootSrc) {
-		if err := copyTemplateTree(rootSrc, root, vars, true); err != nil {
-			return err
+	var orphans []OrphanBlock
+	for _, f := range files {
+		if strings.HasPrefix(f.Path, "common/") {
+			t.Remove("common")
+			manifest.RemovePrefix("common")
+			// Blocks in files the pack no longer renders are lost with them.
+			gone, err := commonOrphans(root, files)
+			if err != nil {
+				return nil, err
+			}
+			orphans = append(orphans, gone...)
+			break
 		}
 	}
 
-	if err := runGoModTidy(root); err != nil {
-		return err
+	for _, f := range files {
+		if f.Path == ServiceConfigPath(serviceName) {
+			c, changed, err := PlanServiceConfig(root, serviceName, cfg, f.Content)
+			if err != nil {
+				return nil, err
+			}
+			if changed {
+				if err := t.Write(c.Path, c.New); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		content := f.Content
+		if existing, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(f.Path))); err == nil {
+			if content, err = ApplyKeepBlocks(f.Content, existing); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Path, err)
+			}
+			orphans = append(orphans, MissingKeepBlocks(f.Path, existing, content)...)
+		}
+		if err := t.Write(f.Path, content); err != nil {
+			return nil, err
+		}
+		if err := t.SaveGenerated(f.Path, f.Content); err != nil {
+			return nil, err
+		}
+		manifest.Record(p, vars, f)
 	}
-
-	return nil
+	return orphans, t.SaveManifest(manifest)
 }
 
-func copyTemplateTree(src, dst string, vars TemplateData, overwrite bool) error {
-	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+// commonOrphans returns the keep-blocks of files in common/ that are not
+// among the rendered files.
+func commonOrphans(root string, files []File) ([]OrphanBlock, error) {
+	rendered := make(map[string]bool, len(files))
+	for _, f := range files {
+		rendered[f.Path] = true
+	}
+	var orphans []OrphanBlock
+	err := filepath.WalkDir(filepath.Join(root, "common"), func(p string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rendered[rel] {
+			return nil
+		}
+		data, err := os.ReadFile(p)
 		if err != nil {
 			return err
 		}
-		rel, err := filepath.Rel(src, path)
+		orphans = append(orphans, MissingKeepBlocks(rel, data, nil)...)
+		return nil
+	})
+	return orphans, err
+}
+
+// renderTemplateTree renders every file under templates/<tree.src> of the
+// pack. Path segments may be templates themselves, files are left out when
+// a condition does not hold, and templates rendering only whitespace are
+// skipped. Files that fail are skipped too, and their errors returned
+// joined once the whole tree is rendered.
+func renderTemplateTree(p Pack, tree templateTree, vars TemplateData) ([]File, error) {
+	src := path.Join("templates", tree.src)
+	var files []File
+	var errs []error
+	err := fs.WalkDir(p.FS, src, func(filePath string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
-		outPath := filepath.Join(dst, rel)
-		if info.IsDir() {
-			return os.MkdirAll(outPath, 0o755)
+		ok, err := included(p, filePath, vars)
+		if err != nil {
+			errs = append(errs, err)
+			ok = false
+		}
+		if !ok {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
 		}
-		if strings.HasSuffix(outPath, ".tmpl") {
-			outPath = strings.TrimSuffix(outPath, ".tmpl")
+		if d.IsDir() {
+			if slices.Contains(tree.skip, filePath) {
+				return fs.SkipDir
+			}
+			return nil
 		}
-		if !overwrite && pathExists(outPath) {
+		rel := strings.TrimPrefix(filePath, src+"/")
+		outRel, err := renderPath(strings.TrimSuffix(rel, ".tmpl"), vars)
+		if err != nil {
+			errs = append(errs, &templateError{file: filePath, what: "file name", err: err})
 			return nil
 		}
-		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
-			return err
+		if outRel == "" {
+			return nil
 		}
 
-		if isLikelyText(path) || strings.HasSuffix(path, ".tmpl") {
-			return renderTemplateFile(path, outPath, vars)
+		var content []byte
+		if isLikelyText(filePath) || strings.HasSuffix(filePath, ".tmpl") {
+			content, err = renderTemplateFile(p.FS, filePath, vars)
+			if err == nil && len(bytes.TrimSpace(content)) == 0 {
+				return nil
+			}
+		} else {
+			content, err = fs.ReadFile(p.FS, filePath)
+		}
+		if err != nil {
+			var te *templateError
+			if !errors.As(err, &te) {
+				err = &templateError{file: filePath, err: err}
+			}
+			errs = append(errs, err)
+			return nil
 		}
-		return copyFile(path, outPath)
+		content = FormatGo(outRel, content)
+		files = append(files, File{
+			Path:     path.Join(tree.dst, outRel),
+			Template: path.Join(tree.src, rel),
+			Content:  content,
+		})
+		return nil
 	})
+	if err != nil {
+		errs = append(errs, err)
+	}
+	return files, errors.Join(errs...)
 }
 
-func copyFile(src, dst string) error {
-	in, err := os.Open(src)
-	if err != nil {
-		return err
+// templateError is an error rendering one file of a pack, located so that
+// CheckTemplates can report it against the pack file at fault. Its message
+// is that of the underlying error.
+type templateError struct {
+	// file is the pack path at fault: the template, or pack.toml for the
+	// conditions declared there.
+	file string
+	// line is the line in file, 0 when unknown.
+	line int
+	// what names the part of the file that failed, e.g. "front-matter when".
+	what string
+	err  error
+}
+
+func (e *templateError) Error() string { return e.err.Error() }
+
+func (e *templateError) Unwrap() error { return e.err }
+
+// FormatGo gofmts the content of a Go file, so that templates and merges
+// need not align fields and comments the way gofmt does. Other files and
+// source that does not parse are returned as is; CheckTemplates reports the
+// latter.
+func FormatGo(name string, content []byte) []byte {
+	if path.Ext(name) != ".go" {
+		return content
 	}
-	defer in.Close()
-	out, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	formatted, err := format.Source(content)
 	if err != nil {
-		return err
+		return content
 	}
-	defer out.Close()
-	if _, err := io.Copy(out, in); err != nil {
+	return formatted
+}
+
+func writeContent(dst string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
 		return err
 	}
-	return nil
+	return os.WriteFile(dst, content, 0o644)
 }
 
 func isLikelyText(path string) bool {
@@ -223,23 +537,58 @@ func isLikelyText(path string) bool {
 	return false
 }
 
-func renderTemplateFile(src, dst string, vars TemplateData) error {
-	raw, err := os.ReadFile(src)
+func renderTemplateFile(fsys fs.FS, src string, vars TemplateData) ([]byte, error) {
+	raw, err := fs.ReadFile(fsys, src)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	fm, body, err := splitFrontMatter(raw)
+	if err != nil {
+		return nil, &templateError{file: src, line: 1, err: fmt.Errorf("%s: %w", src, err)}
+	}
+	if fm.When != "" {
+		ok, err := EvalCondition(fm.When, vars)
+		if err != nil {
+			// The when key follows the opening delimiter.
+			return nil, &templateError{file: src, line: 2, what: "front-matter when", err: fmt.Errorf("%s: condition: %w", src, err)}
+		}
+		if !ok {
+			return nil, nil
+		}
 	}
 
-	tpl, err := template.New(filepath.Base(src)).Funcs(templateFuncMap()).Parse(string(raw))
+	// Errors in the body are located in the template, front-matter included.
+	bodyError := func(err error) error {
+		line := templateProblem(err).Line
+		if line > 0 {
+			line += bytes.Count(raw[:len(raw)-len(body)], []byte("\n"))
+		}
+		return &templateError{file: src, line: line, err: err}
+	}
+	tpl, err := template.New(src).Funcs(templateFuncMap()).Parse(string(body))
 	if err != nil {
-		return err
+		return nil, bodyError(err)
 	}
 
 	var buf bytes.Buffer
 	if err := tpl.Execute(&buf, vars); err != nil {
-		return err
+		return nil, bodyError(err)
 	}
 
-	return os.WriteFile(dst, buf.Bytes(), 0o644)
+	return buf.Bytes(), nil
+}
+
+// RenderString renders a single template string, such as a pack command argument.
+func RenderString(text string, vars TemplateData) (string, error) {
+	tpl, err := template.New("arg").Funcs(templateFuncMap()).Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, vars); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
 }
 
 func templateFuncMap() template.FuncMap {
@@ -327,40 +676,7 @@ func pathExists(p string) bool {
 	return err == nil
 }
 
-func runGoModTidy(root string) error {
-	cmd := exec.Command("go", "mod", "tidy")
-	cmd.Dir = root
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
-}
-
-func findLocalPack(root, lang string) (*Pack, error) {
-	// Search current and parent directories for pack/lang/<lang>
-	langLower := strings.ToLower(lang)
-	maxAscend := 5
-	cur := root
-	for i := 0; i <= maxAscend; i++ {
-		candidate := filepath.Join(cur, "pack", "lang", langLower)
-		info, err := os.Stat(candidate)
-		if err == nil && info.IsDir() {
-			// Optional safety: ensure templates/service exists
-			if pathExists(filepath.Join(candidate, "templates", "service")) {
-				meta := Metadata{
-					ID:      "local-" + langLower,
-					Name:    strings.Title(langLower) + " pack",
-					Lang:    lang,
-					Version: "0.0.0",
-				}
-				return &Pack{Meta: meta, BaseDir: candidate}, nil
-			}
-		}
-		// Move up one directory
-		parent := filepath.Dir(cur)
-		if parent == cur { // reached filesystem root
-			break
-		}
-		cur = parent
-	}
-	return nil, nil
+func fsExists(fsys fs.FS, name string) bool {
+	_, err := fs.Stat(fsys, name)
+	return err == nil
 }
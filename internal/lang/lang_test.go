@@ -0,0 +1,91 @@
+package lang
+
+import (
+	"bytes"
+	"go/format"
+	"io/fs"
+	"path"
+	"testing"
+
+	"micromanager/internal/config"
+	"micromanager/pack"
+)
+
+func builtinPack(t *testing.T, id string) Pack {
+	t.Helper()
+	fsys, err := fs.Sub(pack.Builtin, path.Join("lang", id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := LoadPackFS(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+const twoOperations = `
+[[operations]]
+name = "GetOrder"
+method = "GET"
+path = "/orders/:id"
+request = "GetOrderRequest"
+response = "Order"
+
+[[operations]]
+name = "DeleteOrder"
+method = "DELETE"
+path = "/orders/{order_id}"
+request = "DeleteOrderRequest"
+
+[[operations]]
+name = "Ping"
+method = "GET"
+path = "/ping"
+
+[[types]]
+name = "GetOrderRequest"
+fields = [{name = "ID", type = "string"}, {name = "Verbose", type = "bool"}]
+
+[[types]]
+name = "DeleteOrderRequest"
+fields = [{name = "OrderID", type = "string"}]
+
+[[types]]
+name = "Order"
+fields = [{name = "ID", type = "string"}, {name = "LineItems", type = "[]string"}]
+`
+
+func TestRenderFormatsGo(t *testing.T) {
+	api, err := config.ParseAPI([]byte(twoOperations))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := Render(builtinPack(t, "go"), TemplateData{
+		ProjectName: "shop",
+		ServiceName: "orders",
+		API:         NewAPIData(*api),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checked := 0
+	for _, f := range files {
+		if path.Ext(f.Path) != ".go" {
+			continue
+		}
+		checked++
+		formatted, err := format.Source(f.Content)
+		if err != nil {
+			t.Errorf("%s: %v", f.Path, err)
+			continue
+		}
+		if !bytes.Equal(formatted, f.Content) {
+			t.Errorf("%s is not gofmt-clean", f.Path)
+		}
+	}
+	if checked == 0 {
+		t.Fatal("no Go files rendered")
+	}
+}
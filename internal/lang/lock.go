@@ -0,0 +1,129 @@
+package lang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// Lock records the packs installed into .mm/packs. It is stored in
+// .mm/packs.lock.
+type Lock struct {
+	Packs []LockEntry `toml:"packs"`
+}
+
+// LockEntry describes a single installed pack.
+type LockEntry struct {
+	ID      string `toml:"id"`
+	Version string `toml:"version"`
+	// Source is the directory, tarball or git URL the pack was installed from.
+	Source string `toml:"source"`
+	// Checksum is the TreeChecksum of the installed pack directory.
+	Checksum string `toml:"checksum"`
+}
+
+// LockPath returns the location of the pack lock file.
+func LockPath(root string) string {
+	return filepath.Join(root, ".mm", "packs.lock")
+}
+
+// LoadLock reads .mm/packs.lock. A missing lock file is returned empty.
+func LoadLock(root string) (*Lock, error) {
+	data, err := os.ReadFile(LockPath(root))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &Lock{}, nil
+		}
+		return nil, err
+	}
+	var l Lock
+	if err := toml.Unmarshal(data, &l); err != nil {
+		return nil, err
+	}
+	return &l, nil
+}
+
+// SaveLock writes .mm/packs.lock with entries sorted by ID.
+func SaveLock(root string, l *Lock) error {
+	sort.Slice(l.Packs, func(i, j int) bool {
+		return l.Packs[i].ID < l.Packs[j].ID
+	})
+	path := LockPath(root)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := toml.Marshal(l)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Lookup returns the entry for a pack ID.
+func (l *Lock) Lookup(id string) (LockEntry, bool) {
+	for _, e := range l.Packs {
+		if e.ID == id {
+			return e, true
+		}
+	}
+	return LockEntry{}, false
+}
+
+// Set adds or replaces the entry for e.ID.
+func (l *Lock) Set(e LockEntry) {
+	l.Remove(e.ID)
+	l.Packs = append(l.Packs, e)
+}
+
+// Remove drops the entry for a pack ID.
+func (l *Lock) Remove(id string) {
+	kept := l.Packs[:0]
+	for _, e := range l.Packs {
+		if e.ID != id {
+			kept = append(kept, e)
+		}
+	}
+	l.Packs = kept
+}
+
+// TreeHashes returns the HashContent of every file in fsys by slash path.
+func TreeHashes(fsys fs.FS) (map[string]string, error) {
+	hashes := make(map[string]string)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return err
+		}
+		hashes[p] = HashContent(data)
+		return nil
+	})
+	return hashes, err
+}
+
+// TreeChecksum returns a checksum over the paths and contents of every file
+// in fsys.
+func TreeChecksum(fsys fs.FS) (string, error) {
+	hashes, err := TreeHashes(fsys)
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, 0, len(hashes))
+	for p := range hashes {
+		paths = append(paths, p)
+	}
+	sort.Strings(paths)
+	h := sha256.New()
+	for _, p := range paths {
+		h.Write([]byte(p + "\x00" + hashes[p] + "\n"))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
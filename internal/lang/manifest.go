@@ -0,0 +1,136 @@
+package lang
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+)
+
+// Manifest records which pack and template produced every generated file.
+// It is stored in .mm/manifest.toml.
+type Manifest struct {
+	Files []ManifestEntry `toml:"files"`
+}
+
+// ManifestEntry describes a single generated file.
+type ManifestEntry struct {
+	Path        string       `toml:"path"`
+	Service     string       `toml:"service"`
+	Pack        string       `toml:"pack"`
+	PackVersion string       `toml:"pack_version"`
+	Template    string       `toml:"template"`
+	Hash        string       `toml:"hash"`
+	Data        TemplateData `toml:"data"`
+}
+
+// ManifestPath returns the location of the generation manifest.
+func ManifestPath(root string) string {
+	return filepath.Join(root, ".mm", "manifest.toml")
+}
+
+// LoadManifest reads .mm/manifest.toml. A missing manifest is returned empty.
+func LoadManifest(root string) (*Manifest, error) {
+	data, err := os.ReadFile(ManifestPath(root))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return &Manifest{}, nil
+		}
+		return nil, err
+	}
+	var m Manifest
+	if err := toml.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// MarshalManifest encodes a manifest with entries sorted by path.
+func MarshalManifest(m *Manifest) ([]byte, error) {
+	sort.Slice(m.Files, func(i, j int) bool {
+		return m.Files[i].Path < m.Files[j].Path
+	})
+	return toml.Marshal(m)
+}
+
+// Record adds or replaces the entry for a rendered file. Files outside the
+// service directory, such as common/ and go.mod, are shared by every service
+// and recorded without one, so that updating another service leaves their
+// entries alone.
+func (m *Manifest) Record(p Pack, vars TemplateData, f File) {
+	entry := ManifestEntry{
+		Path:        f.Path,
+		Service:     vars.ServiceName,
+		Pack:        p.Meta.ID,
+		PackVersion: p.Meta.Version,
+		Template:    f.Template,
+		Hash:        HashContent(f.Content),
+		Data:        vars,
+	}
+	if !strings.HasPrefix(f.Path, path.Join("services", vars.ServiceName)+"/") {
+		entry.Service = ""
+		entry.Data = TemplateData{ProjectName: vars.ProjectName}
+	}
+	for i := range m.Files {
+		if m.Files[i].Path == f.Path {
+			m.Files[i] = entry
+			return
+		}
+	}
+	m.Files = append(m.Files, entry)
+}
+
+// Rehash records new content for the entry of a repo-relative path, if there
+// is one, such as a file mm edited after generating it.
+func (m *Manifest) Rehash(relPath string, content []byte) {
+	for i := range m.Files {
+		if m.Files[i].Path == relPath {
+			m.Files[i].Hash = HashContent(content)
+		}
+	}
+}
+
+// Lookup returns the entry for a repo-relative path.
+func (m *Manifest) Lookup(relPath string) (ManifestEntry, bool) {
+	for _, e := range m.Files {
+		if e.Path == relPath {
+			return e, true
+		}
+	}
+	return ManifestEntry{}, false
+}
+
+// Remove drops the entry for a repo-relative path.
+func (m *Manifest) Remove(relPath string) {
+	m.removeFunc(func(e ManifestEntry) bool { return e.Path == relPath })
+}
+
+// RemovePrefix drops every entry below a slash-separated directory prefix.
+func (m *Manifest) RemovePrefix(prefix string) {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	m.removeFunc(func(e ManifestEntry) bool { return strings.HasPrefix(e.Path, prefix) })
+}
+
+func (m *Manifest) removeFunc(drop func(ManifestEntry) bool) {
+	kept := m.Files[:0]
+	for _, e := range m.Files {
+		if !drop(e) {
+			kept = append(kept, e)
+		}
+	}
+	m.Files = kept
+}
+
+// HashContent returns the content hash stored in the manifest. The bodies of
+// keep-blocks are left out, as they belong to the user.
+func HashContent(content []byte) string {
+	sum := sha256.Sum256(stripKeepBlocks(content))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,189 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DeleteMarkerSuffix marks an inherited file or directory as deleted: a
+// child pack containing templates/service/Dockerfile.tmpl.mm-delete drops
+// the parent's templates/service/Dockerfile.tmpl.
+const DeleteMarkerSuffix = ".mm-delete"
+
+// resolveAt returns found[i] with its parents merged in. A pack extending
+// its own ID inherits from the next pack with that ID in lookup order.
+func resolveAt(found []Found, i int, visiting map[int]bool) (Pack, error) {
+	p := found[i].Pack
+	parentID := p.Meta.Extends
+	if parentID == "" {
+		return p, nil
+	}
+	if visiting == nil {
+		visiting = make(map[int]bool)
+	}
+	if visiting[i] {
+		return Pack{}, fmt.Errorf("extends %q: inheritance cycle", parentID)
+	}
+	visiting[i] = true
+	defer delete(visiting, i)
+
+	parent := -1
+	for j, f := range found {
+		if j == i || f.Err != nil || f.Pack.Meta.ID != parentID {
+			continue
+		}
+		if parentID == p.Meta.ID && j < i {
+			continue
+		}
+		parent = j
+		break
+	}
+	if parent < 0 {
+		return Pack{}, fmt.Errorf("extends %q: no such pack", parentID)
+	}
+	base, err := resolveAt(found, parent, visiting)
+	if err != nil {
+		return Pack{}, fmt.Errorf("extends %q: %w", parentID, err)
+	}
+	return extendPack(p, base), nil
+}
+
+// extendPack overlays child on parent. Templates of the child replace the
+// parent's, variables and requirements are merged by name, file conditions
+// of both apply, and the child's test command, hooks and service types are
+// used when it declares them.
+func extendPack(child, parent Pack) Pack {
+	m := child.Meta
+	pm := parent.Meta
+
+	vars := append([]Variable(nil), pm.Variables...)
+	for _, v := range m.Variables {
+		replaced := false
+		for i := range vars {
+			if vars[i].Name == v.Name {
+				vars[i] = v
+				replaced = true
+			}
+		}
+		if !replaced {
+			vars = append(vars, v)
+		}
+	}
+	m.Variables = vars
+
+	reqs := append([]Requirement(nil), pm.Requires...)
+	for _, r := range m.Requires {
+		replaced := false
+		for i := range reqs {
+			if reqs[i].Tool == r.Tool {
+				reqs[i] = r
+				replaced = true
+			}
+		}
+		if !replaced {
+			reqs = append(reqs, r)
+		}
+	}
+	m.Requires = reqs
+
+	m.Files = append(append([]FileCondition(nil), pm.Files...), m.Files...)
+
+	if m.Lang == "" {
+		m.Lang = pm.Lang
+	}
+	if m.MMVersion == "" {
+		m.MMVersion = pm.MMVersion
+	}
+	if len(m.ServiceTypes) == 0 {
+		m.ServiceTypes = pm.ServiceTypes
+	}
+	if len(m.Hooks.PostGenerate) == 0 {
+		m.Hooks = pm.Hooks
+	}
+	if len(m.Test.Command) == 0 {
+		m.Test = pm.Test
+	}
+
+	child.Meta = m
+	child.FS = overlayFS{upper: child.FS, lower: parent.FS}
+	return child
+}
+
+// overlayFS shows the files of upper on top of those of lower, minus the
+// lower files that upper marks as deleted.
+type overlayFS struct {
+	upper fs.FS
+	lower fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if strings.HasSuffix(name, DeleteMarkerSuffix) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	f, err := o.upper.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	if o.deleted(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return o.lower.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	upper, upperErr := fs.ReadDir(o.upper, name)
+	if upperErr != nil && !errors.Is(upperErr, fs.ErrNotExist) {
+		return nil, upperErr
+	}
+	var lower []fs.DirEntry
+	lowerErr := fs.ErrNotExist
+	if !o.deleted(name) {
+		lower, lowerErr = fs.ReadDir(o.lower, name)
+		if lowerErr != nil && !errors.Is(lowerErr, fs.ErrNotExist) {
+			return nil, lowerErr
+		}
+	}
+	if upperErr != nil && lowerErr != nil {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make(map[string]fs.DirEntry)
+	deleted := make(map[string]bool)
+	for _, e := range upper {
+		if target, ok := strings.CutSuffix(e.Name(), DeleteMarkerSuffix); ok {
+			deleted[target] = true
+			continue
+		}
+		entries[e.Name()] = e
+	}
+	for _, e := range lower {
+		if _, ok := entries[e.Name()]; !ok && !deleted[e.Name()] {
+			entries[e.Name()] = e
+		}
+	}
+
+	list := make([]fs.DirEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+	return list, nil
+}
+
+// deleted reports whether upper marks name or one of its parent
+// directories as deleted.
+func (o overlayFS) deleted(name string) bool {
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		if _, err := fs.Stat(o.upper, p+DeleteMarkerSuffix); err == nil {
+			return true
+		}
+	}
+	return false
+}
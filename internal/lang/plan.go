@@ -0,0 +1,167 @@
+package lang
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"micromanager/internal/config"
+)
+
+// ChangeKind classifies a planned file change.
+type ChangeKind string
+
+const (
+	ChangeCreated  ChangeKind = "created"
+	ChangeModified ChangeKind = "modified"
+	ChangeDeleted  ChangeKind = "deleted"
+)
+
+// Change is a modification of one repository file that generation would
+// make. Old is nil for created files and New is nil for deleted ones.
+type Change struct {
+	Path string
+	Kind ChangeKind
+	Old  []byte
+	New  []byte
+}
+
+// PlanFile compares content with the file at path in the repository. It
+// reports false when writing content would change nothing.
+func PlanFile(root, path string, content []byte) (Change, bool, error) {
+	old, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Change{Path: path, Kind: ChangeCreated, New: content}, true, nil
+	}
+	if err != nil {
+		return Change{}, false, err
+	}
+	if bytes.Equal(old, content) {
+		return Change{}, false, nil
+	}
+	return Change{Path: path, Kind: ChangeModified, Old: old, New: content}, true, nil
+}
+
+// PlanDelete returns the change removing the file at path, if it exists.
+func PlanDelete(root, path string) (Change, bool, error) {
+	old, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(path)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Change{}, false, nil
+	}
+	if err != nil {
+		return Change{}, false, err
+	}
+	return Change{Path: path, Kind: ChangeDeleted, Old: old}, true, nil
+}
+
+// PlanServiceConfig returns the service.toml that merging the environment
+// defaults of a rendered service.toml into cfg would produce. An existing
+// file is only rewritten when defaults are added.
+func PlanServiceConfig(root, serviceName string, cfg config.ServiceConfig, rendered []byte) (Change, bool, error) {
+	added := false
+	if rendered != nil {
+		fragment, err := config.ParseServiceConfig(rendered)
+		if err != nil {
+			return Change{}, false, fmt.Errorf("parse pack service.toml: %w", err)
+		}
+		added = cfg.AddEnvironment(fragment.Environment)
+	}
+	if !added && pathExists(filepath.Join(root, filepath.FromSlash(ServiceConfigPath(serviceName)))) {
+		return Change{}, false, nil
+	}
+	data, err := config.MarshalServiceConfig(cfg)
+	if err != nil {
+		return Change{}, false, err
+	}
+	return PlanFile(root, ServiceConfigPath(serviceName), data)
+}
+
+// PlanService renders a service with cfg and returns the changes StageService
+// would make, without touching the filesystem.
+func PlanService(root string, p Pack, serviceName string, cfg config.ServiceConfig) ([]Change, error) {
+	vars, err := LoadTemplateData(root, serviceName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	files, err := Render(p, vars)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []Change
+	var renderedConfig []byte
+	rendered := make(map[string]bool)
+	rendersCommon := false
+	for _, f := range files {
+		rendered[f.Path] = true
+		if f.Path == ServiceConfigPath(serviceName) {
+			renderedConfig = f.Content
+			continue
+		}
+		if strings.HasPrefix(f.Path, "common/") {
+			rendersCommon = true
+		}
+		content := f.Content
+		if existing, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(f.Path))); err == nil {
+			if content, err = ApplyKeepBlocks(f.Content, existing); err != nil {
+				return nil, fmt.Errorf("%s: %w", f.Path, err)
+			}
+		}
+		c, ok, err := PlanFile(root, f.Path, content)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			changes = append(changes, c)
+		}
+	}
+
+	c, ok, err := PlanServiceConfig(root, serviceName, cfg, renderedConfig)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		changes = append(changes, c)
+	}
+
+	// StageService replaces common/ wholesale.
+	if rendersCommon {
+		err := filepath.WalkDir(filepath.Join(root, "common"), func(p string, d fs.DirEntry, err error) error {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			if err != nil || d.IsDir() {
+				return err
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if rendered[rel] {
+				return nil
+			}
+			c, ok, err := PlanDelete(root, rel)
+			if ok {
+				changes = append(changes, c)
+			}
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	SortChanges(changes)
+	return changes, nil
+}
+
+// SortChanges orders changes by path.
+func SortChanges(changes []Change) {
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+}
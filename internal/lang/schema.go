@@ -0,0 +1,425 @@
+package lang
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	toml "github.com/pelletier/go-toml/v2"
+
+	"micromanager/internal/version"
+)
+
+// Variable types accepted in a pack manifest.
+const (
+	VarString = "string"
+	VarInt    = "int"
+	VarBool   = "bool"
+	VarList   = "list"
+)
+
+// Variable declares a template variable a pack accepts in addition to the
+// built-in template data.
+type Variable struct {
+	Name    string `toml:"name"`
+	Type    string `toml:"type"`
+	Default any    `toml:"default,omitempty"`
+	Prompt  string `toml:"prompt,omitempty"`
+}
+
+// Requirement names an external tool the pack needs, with an optional
+// version constraint such as ">=1.21" on the version the tool reports with
+// --version, or version as go does.
+type Requirement struct {
+	Tool    string `toml:"tool"`
+	Version string `toml:"version,omitempty"`
+}
+
+// Hooks groups the commands a pack runs around generation.
+type Hooks struct {
+	PostGenerate []Hook `toml:"post_generate,omitempty"`
+}
+
+// Hook directories.
+const (
+	HookDirRoot    = "root"
+	HookDirService = "service"
+)
+
+// Hook is a command run after files are generated.
+type Hook struct {
+	Name    string            `toml:"name,omitempty"`
+	Command []string          `toml:"command"`
+	Dir     string            `toml:"dir,omitempty"`
+	Env     map[string]string `toml:"env,omitempty"`
+	// Timeout is a duration such as "2m"; DefaultHookTimeout applies when empty.
+	Timeout string `toml:"timeout,omitempty"`
+	// Optional hooks only warn when they fail.
+	Optional bool `toml:"optional,omitempty"`
+}
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Validate checks a pack manifest against the schema and reports every
+// problem found.
+func Validate(p Pack) error {
+	var errs []error
+	m := p.Meta
+	if m.ID == "" {
+		errs = append(errs, errors.New("missing id"))
+	}
+	if m.Lang == "" {
+		errs = append(errs, errors.New("missing lang"))
+	}
+	if m.Version == "" {
+		errs = append(errs, errors.New("missing version"))
+	} else if _, err := version.Compare(m.Version, "0"); err != nil {
+		errs = append(errs, fmt.Errorf("version: %w", err))
+	}
+	if m.MMVersion != "" {
+		if ok, err := version.Satisfies(version.Version, m.MMVersion); err != nil {
+			errs = append(errs, fmt.Errorf("mm_version: %w", err))
+		} else if !ok {
+			errs = append(errs, fmt.Errorf("requires mm %s, this is mm %s", m.MMVersion, version.Version))
+		}
+	}
+
+	seenTypes := make(map[string]bool)
+	for _, t := range m.ServiceTypes {
+		switch {
+		case t.Name == "":
+			errs = append(errs, errors.New("service_types: empty type"))
+		case strings.ContainsAny(t.Name, "/\\") || t.Name == "." || t.Name == "..":
+			errs = append(errs, fmt.Errorf("service_types: type %q must be a directory name", t.Name))
+		case seenTypes[t.Name]:
+			errs = append(errs, fmt.Errorf("service_types: duplicate type %q", t.Name))
+		}
+		seenTypes[t.Name] = true
+		if t.Ready != "" && t.Ready != ReadyPort && t.Ready != ReadyStarted {
+			errs = append(errs, fmt.Errorf("service_types: type %q: ready must be %q or %q", t.Name, ReadyPort, ReadyStarted))
+		}
+		switch {
+		case t.Health == "":
+		case !t.Listens():
+			errs = append(errs, fmt.Errorf("service_types: type %q: health needs a type that listens", t.Name))
+		case !strings.HasPrefix(t.Health, "/"):
+			errs = append(errs, fmt.Errorf("service_types: type %q: health must be a path starting with /", t.Name))
+		}
+	}
+
+	seenVars := make(map[string]bool)
+	for _, v := range m.Variables {
+		switch {
+		case !identifierRe.MatchString(v.Name):
+			errs = append(errs, fmt.Errorf("variable %q: name must be an identifier", v.Name))
+		case seenVars[v.Name]:
+			errs = append(errs, fmt.Errorf("variable %q: declared twice", v.Name))
+		}
+		seenVars[v.Name] = true
+		if !validVarType(v.Type) {
+			errs = append(errs, fmt.Errorf("variable %q: unknown type %q", v.Name, v.Type))
+		} else if v.Default != nil {
+			if _, err := CoerceVar(v, v.Default); err != nil {
+				errs = append(errs, fmt.Errorf("variable %q: default: %w", v.Name, err))
+			}
+		}
+	}
+
+	for _, r := range m.Requires {
+		if r.Tool == "" {
+			errs = append(errs, errors.New("requires: missing tool"))
+		}
+		if err := version.ValidConstraint(r.Version); err != nil {
+			errs = append(errs, fmt.Errorf("requires %s: %w", r.Tool, err))
+		}
+	}
+
+	for i, h := range m.Hooks.PostGenerate {
+		name := h.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if len(h.Command) == 0 {
+			errs = append(errs, fmt.Errorf("hook %s: missing command", name))
+		}
+		if h.Dir != "" && h.Dir != HookDirRoot && h.Dir != HookDirService {
+			errs = append(errs, fmt.Errorf("hook %s: dir must be %q or %q", name, HookDirRoot, HookDirService))
+		}
+		if h.Timeout != "" {
+			if d, err := time.ParseDuration(h.Timeout); err != nil || d <= 0 {
+				errs = append(errs, fmt.Errorf("hook %s: invalid timeout %q", name, h.Timeout))
+			}
+		}
+	}
+
+	for _, c := range m.Files {
+		if c.Path == "" || c.When == "" {
+			errs = append(errs, fmt.Errorf("files: condition needs path and when"))
+			continue
+		}
+		if _, err := template.New("when").Funcs(templateFuncMap()).Parse("{{if " + c.When + "}}{{end}}"); err != nil {
+			errs = append(errs, fmt.Errorf("files %s: %w", c.Path, err))
+		}
+	}
+
+	if _, err := fs.Stat(p.FS, "templates/service"); err != nil {
+		errs = append(errs, fmt.Errorf("missing templates/service: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+func validVarType(t string) bool {
+	switch t {
+	case VarString, VarInt, VarBool, VarList:
+		return true
+	}
+	return false
+}
+
+// CoerceVar converts a value decoded from TOML to the declared variable type.
+func CoerceVar(v Variable, value any) (any, error) {
+	switch v.Type {
+	case VarString:
+		if s, ok := value.(string); ok {
+			return s, nil
+		}
+	case VarInt:
+		switch n := value.(type) {
+		case int64:
+			return int(n), nil
+		case int:
+			return n, nil
+		}
+	case VarBool:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+	case VarList:
+		switch l := value.(type) {
+		case []string:
+			return l, nil
+		case []any:
+			out := make([]string, 0, len(l))
+			for _, item := range l {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("expected a list of strings, got %v", value)
+				}
+				out = append(out, s)
+			}
+			return out, nil
+		}
+	default:
+		return nil, fmt.Errorf("unknown type %q", v.Type)
+	}
+	return nil, fmt.Errorf("expected %s, got %v", v.Type, value)
+}
+
+// MissingTools lists the required tools that are not on PATH or whose
+// version does not satisfy the requirement, each as the tool and why, e.g.
+// "go: version 1.20.3, want >=1.21".
+func MissingTools(p Pack) []string {
+	var missing []string
+	for _, r := range p.Meta.Requires {
+		if err := checkTool(r); err != nil {
+			missing = append(missing, r.Tool+": "+err.Error())
+		}
+	}
+	return missing
+}
+
+// checkTool checks that a required tool is on PATH and reports a version
+// satisfying the requirement.
+func checkTool(r Requirement) error {
+	if _, err := exec.LookPath(r.Tool); err != nil {
+		return errors.New("not found on PATH")
+	}
+	if r.Version == "" {
+		return nil
+	}
+	v, err := toolVersion(r.Tool)
+	if err != nil {
+		return fmt.Errorf("%w, want %s", err, r.Version)
+	}
+	ok, err := version.Satisfies(v, r.Version)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("version %s, want %s", v, r.Version)
+	}
+	return nil
+}
+
+// toolVersionTimeout bounds each attempt of toolVersion.
+const toolVersionTimeout = 10 * time.Second
+
+var toolVersionRe = regexp.MustCompile(`\d+(?:\.\d+)+`)
+
+// toolVersion returns the first dotted number a tool prints for --version
+// or, failing that, for version, which covers go ("go version go1.24.5").
+func toolVersion(tool string) (string, error) {
+	for _, arg := range []string{"--version", "version"} {
+		ctx, cancel := context.WithTimeout(context.Background(), toolVersionTimeout)
+		out, err := exec.CommandContext(ctx, tool, arg).Output()
+		cancel()
+		if err != nil {
+			continue
+		}
+		if v := toolVersionRe.Find(out); v != nil {
+			return string(v), nil
+		}
+	}
+	return "", errors.New("version unknown")
+}
+
+// FindVariable returns the variable the pack declares under name.
+func FindVariable(p Pack, name string) (Variable, bool) {
+	for _, v := range p.Meta.Variables {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return Variable{}, false
+}
+
+// ParseVar converts a command line value to the variable type. Lists are
+// comma-separated.
+func ParseVar(v Variable, s string) (any, error) {
+	switch v.Type {
+	case VarString:
+		return s, nil
+	case VarInt:
+		n, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("expected int, got %q", s)
+		}
+		return n, nil
+	case VarBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(s))
+		if err != nil {
+			return nil, fmt.Errorf("expected bool, got %q", s)
+		}
+		return b, nil
+	case VarList:
+		list := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		return list, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", v.Type)
+}
+
+// CollectVars validates user-supplied values against the variables the pack
+// declares. values come from a TOML file, set from --set key=value flags and
+// take precedence. Only the supplied values are returned, converted to
+// their declared types.
+func CollectVars(p Pack, values map[string]any, set map[string]string) (map[string]any, error) {
+	out := make(map[string]any)
+	var errs []error
+	for name, value := range values {
+		v, ok := FindVariable(p, name)
+		if !ok {
+			errs = append(errs, unknownVarError(p, name))
+			continue
+		}
+		typed, err := CoerceVar(v, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("variable %s: %w", name, err))
+			continue
+		}
+		out[name] = typed
+	}
+	for name, value := range set {
+		v, ok := FindVariable(p, name)
+		if !ok {
+			errs = append(errs, unknownVarError(p, name))
+			continue
+		}
+		typed, err := ParseVar(v, value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("variable %s: %w", name, err))
+			continue
+		}
+		out[name] = typed
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ResolveVars returns every declared variable, taking values from vars and
+// falling back to the declared defaults. Variables without a default and
+// without a value are the zero value of their type.
+func ResolveVars(p Pack, vars map[string]any) (map[string]any, error) {
+	out := make(map[string]any, len(p.Meta.Variables))
+	for _, v := range p.Meta.Variables {
+		value, ok := vars[v.Name]
+		if !ok {
+			value = v.Default
+		}
+		if value == nil {
+			out[v.Name] = zeroVar(v)
+			continue
+		}
+		typed, err := CoerceVar(v, value)
+		if err != nil {
+			return nil, fmt.Errorf("pack %s variable %s: %w", p.Meta.ID, v.Name, err)
+		}
+		out[v.Name] = typed
+	}
+	for name := range vars {
+		if _, ok := FindVariable(p, name); !ok {
+			return nil, unknownVarError(p, name)
+		}
+	}
+	return out, nil
+}
+
+func zeroVar(v Variable) any {
+	switch v.Type {
+	case VarInt:
+		return 0
+	case VarBool:
+		return false
+	case VarList:
+		return []string{}
+	}
+	return ""
+}
+
+func unknownVarError(p Pack, name string) error {
+	names := make([]string, 0, len(p.Meta.Variables))
+	for _, v := range p.Meta.Variables {
+		names = append(names, v.Name)
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("unknown variable %q: pack %s declares no variables", name, p.Meta.ID)
+	}
+	return fmt.Errorf("unknown variable %q (pack %s declares: %s)", name, p.Meta.ID, strings.Join(names, ", "))
+}
+
+// LoadValues reads variable values from a TOML file of top-level keys.
+func LoadValues(path string) (map[string]any, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var values map[string]any
+	if err := toml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,45 @@
+package lang
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMissingToolsChecksVersions(t *testing.T) {
+	dir := t.TempDir()
+	tools := map[string]string{
+		// Answers --version.
+		"lint": "#!/bin/sh\n[ \"$1\" = --version ] && echo 'lint version 1.2.0 (abc123)'\n",
+		// Only answers version, as go does.
+		"gotool": "#!/bin/sh\n[ \"$1\" = version ] || exit 2\necho 'go version go1.24.5 linux/amd64'\n",
+		// Prints no version at all.
+		"quiet": "#!/bin/sh\nexit 0\n",
+	}
+	for name, script := range tools {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(script), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+
+	p := Pack{Meta: Metadata{Requires: []Requirement{
+		{Tool: "lint", Version: ">=1.2"},
+		{Tool: "lint", Version: ">=2"},
+		{Tool: "gotool", Version: ">=1.21, <2"},
+		{Tool: "gotool", Version: ">=1.25"},
+		{Tool: "quiet"},
+		{Tool: "quiet", Version: ">=1"},
+		{Tool: "absent"},
+	}}}
+	want := []string{
+		"lint: version 1.2.0, want >=2",
+		"gotool: version 1.24.5, want >=1.25",
+		"quiet: version unknown, want >=1",
+		"absent: not found on PATH",
+	}
+	if got := MissingTools(p); !reflect.DeepEqual(got, want) {
+		t.Errorf("MissingTools:\n got %q\nwant %q", got, want)
+	}
+}
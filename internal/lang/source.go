@@ -0,0 +1,224 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	toml "github.com/pelletier/go-toml/v2"
+
+	"micromanager/pack"
+)
+
+// Pack sources in lookup order: packs in the repository override the user's
+// packs, which override the packs compiled into mm.
+const (
+	SourceProject = "project"
+	SourceUser    = "user"
+	SourceBuiltin = "builtin"
+)
+
+// ManifestFile is the pack manifest file name. LegacyManifestFile is still
+// read for packs that predate it.
+const (
+	ManifestFile       = "pack.toml"
+	LegacyManifestFile = "language.toml"
+)
+
+// PacksDir returns the project packs directory under the repo root.
+func PacksDir(root string) string {
+	return filepath.Join(root, ".mm", "packs")
+}
+
+// UserPacksDir returns the directory holding the user's packs,
+// $MM_PACKS_DIR or <user config dir>/mm/packs.
+func UserPacksDir() (string, error) {
+	if dir := os.Getenv("MM_PACKS_DIR"); dir != "" {
+		return dir, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "mm", "packs"), nil
+}
+
+// PackDirs lists the candidate pack directories in a packs directory.
+func PackDirs(base string) ([]string, error) {
+	entries, err := os.ReadDir(base)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var dirs []string
+	for _, e := range entries {
+		// Dot directories hold packs being installed or replaced.
+		if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+			dirs = append(dirs, filepath.Join(base, e.Name()))
+		}
+	}
+	return dirs, nil
+}
+
+// LoadPack reads the manifest of the pack in dir without validating it.
+func LoadPack(dir string) (Pack, error) {
+	p, err := LoadPackFS(os.DirFS(dir))
+	if err != nil {
+		return Pack{}, fmt.Errorf("%s: %w", dir, err)
+	}
+	p.BaseDir = dir
+	return p, nil
+}
+
+// LoadPackFS reads the manifest of the pack at the root of fsys without
+// validating it.
+func LoadPackFS(fsys fs.FS) (Pack, error) {
+	name := ManifestFile
+	data, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		name = LegacyManifestFile
+		data, err = fs.ReadFile(fsys, name)
+	}
+	if err != nil {
+		return Pack{}, err
+	}
+	var m Metadata
+	if err := toml.Unmarshal(data, &m); err != nil {
+		return Pack{}, fmt.Errorf("parse %s: %w", name, err)
+	}
+	return Pack{Meta: m, FS: fsys}, nil
+}
+
+// Found is a pack discovered during lookup. Err is set when the pack could
+// not be loaded or is invalid; Name then identifies it.
+type Found struct {
+	Pack Pack
+	Name string
+	Err  error
+}
+
+// Discover finds every pack in lookup order, including invalid ones. Packs
+// that extend another pack are returned with the parent merged in.
+func Discover(root string) ([]Found, error) {
+	found, err := scanPacks(root)
+	if err != nil {
+		return nil, err
+	}
+	resolved := make([]Found, len(found))
+	for i, f := range found {
+		resolved[i] = f
+		if f.Err != nil {
+			continue
+		}
+		p, err := resolveAt(found, i, nil)
+		if err != nil {
+			resolved[i].Err = err
+			continue
+		}
+		resolved[i] = Found{Pack: p, Name: f.Name, Err: Validate(p)}
+	}
+	return resolved, nil
+}
+
+// ResolvePack merges the parents of a pack that is not installed yet,
+// looking them up among the packs of the repository.
+func ResolvePack(root string, p Pack) (Pack, error) {
+	found, err := scanPacks(root)
+	if err != nil {
+		return Pack{}, err
+	}
+	found = append([]Found{{Pack: p, Name: p.Meta.ID}}, found...)
+	return resolveAt(found, 0, nil)
+}
+
+// scanPacks loads the manifest of every pack in lookup order without
+// resolving or validating it.
+func scanPacks(root string) ([]Found, error) {
+	var found []Found
+	scan := func(base, source string) error {
+		dirs, err := PackDirs(base)
+		if err != nil {
+			return err
+		}
+		for _, dir := range dirs {
+			p, err := LoadPack(dir)
+			p.Source = source
+			found = append(found, foundPack(p, filepath.Base(dir), err))
+		}
+		return nil
+	}
+
+	if err := scan(PacksDir(root), SourceProject); err != nil {
+		return nil, err
+	}
+	if userDir, err := UserPacksDir(); err == nil {
+		if err := scan(userDir, SourceUser); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := fs.ReadDir(pack.Builtin, "lang")
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		sub, err := fs.Sub(pack.Builtin, path.Join("lang", e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		p, err := LoadPackFS(sub)
+		p.Source = SourceBuiltin
+		found = append(found, foundPack(p, e.Name(), err))
+	}
+	return found, nil
+}
+
+func foundPack(p Pack, name string, err error) Found {
+	if p.Meta.ID != "" {
+		name = p.Meta.ID
+	}
+	return Found{Pack: p, Name: name, Err: err}
+}
+
+// LoadAll returns the valid packs in lookup order. Packs sharing an ID with
+// an earlier pack are overridden and left out.
+func LoadAll(root string) ([]Pack, error) {
+	found, err := Discover(root)
+	if err != nil {
+		return nil, err
+	}
+	var packs []Pack
+	seen := make(map[string]bool)
+	for _, f := range found {
+		if f.Err != nil || seen[f.Pack.Meta.ID] {
+			continue
+		}
+		seen[f.Pack.Meta.ID] = true
+		packs = append(packs, f.Pack)
+	}
+	return packs, nil
+}
+
+// FindByLang returns the first pack in lookup order matching a given language.
+func FindByLang(root, lang string) (*Pack, error) {
+	packs, err := LoadAll(root)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packs {
+		if strings.EqualFold(p.Meta.Lang, lang) {
+			pp := p
+			return &pp, nil
+		}
+	}
+	return nil, nil
+}
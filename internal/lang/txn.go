@@ -0,0 +1,261 @@
+package lang
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// Txn stages changes to a repository in a temporary directory under .mm and
+// applies them together on Commit. Files replaced or removed by Commit are
+// moved aside first, so Abort can restore the tree as it was before, also
+// after hooks have run.
+type Txn struct {
+	root      string
+	dir       string
+	staged    []string
+	isStaged  map[string]bool
+	removed   []string
+	protected []string
+	undo      []func() error
+	committed bool
+	// keep is set when a rollback failed; the backups are then left in dir.
+	keep bool
+}
+
+// BeginTxn starts a transaction on the repository at root.
+func BeginTxn(root string) (*Txn, error) {
+	base := filepath.Join(root, ".mm")
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(base, ".txn-")
+	if err != nil {
+		return nil, err
+	}
+	return &Txn{root: root, dir: dir, isStaged: make(map[string]bool)}, nil
+}
+
+// Root returns the repository the transaction applies to.
+func (t *Txn) Root() string {
+	return t.root
+}
+
+// Write stages content for a repo-relative path. Writing a path twice keeps
+// the last content.
+func (t *Txn) Write(rel string, content []byte) error {
+	if err := writeContent(t.stagePath(rel), content); err != nil {
+		return err
+	}
+	if !t.isStaged[rel] {
+		t.isStaged[rel] = true
+		t.staged = append(t.staged, rel)
+	}
+	return nil
+}
+
+// Remove stages the removal of a repo-relative file or directory. Removals
+// are applied before the staged files are written.
+func (t *Txn) Remove(rel string) {
+	t.removed = append(t.removed, rel)
+}
+
+// SaveGenerated stages the generated content recorded for a repo-relative path.
+func (t *Txn) SaveGenerated(rel string, content []byte) error {
+	return t.Write(path.Join(".mm", "generated", rel), content)
+}
+
+// RemoveGenerated stages forgetting the recorded content for a repo-relative path.
+func (t *Txn) RemoveGenerated(rel string) {
+	t.Remove(path.Join(".mm", "generated", rel))
+}
+
+// SaveManifest stages .mm/manifest.toml.
+func (t *Txn) SaveManifest(m *Manifest) error {
+	data, err := MarshalManifest(m)
+	if err != nil {
+		return err
+	}
+	return t.Write(path.Join(".mm", "manifest.toml"), data)
+}
+
+// ProtectFiles makes Abort restore the regular files directly in the
+// repo-relative directory dir and delete the ones created there after
+// Commit, such as a go.sum written by a hook.
+func (t *Txn) ProtectFiles(dir string) {
+	t.protected = append(t.protected, dir)
+}
+
+// Commit applies the staged changes. If any step fails, the changes made so
+// far are undone.
+func (t *Txn) Commit() error {
+	if t.committed {
+		return errors.New("transaction already committed")
+	}
+	t.committed = true
+	if err := t.commit(); err != nil {
+		return t.Abort(err)
+	}
+	return nil
+}
+
+func (t *Txn) commit() error {
+	for _, dir := range t.protected {
+		if err := t.snapshot(dir); err != nil {
+			return err
+		}
+	}
+	for _, rel := range t.removed {
+		if err := t.moveAside(rel); err != nil {
+			return err
+		}
+	}
+	for _, rel := range t.staged {
+		if err := t.moveAside(rel); err != nil {
+			return err
+		}
+		target := t.path(rel)
+		if err := t.mkdirAll(filepath.Dir(target)); err != nil {
+			return err
+		}
+		if err := os.Rename(t.stagePath(rel), target); err != nil {
+			return err
+		}
+		t.undo = append(t.undo, func() error {
+			return removeIfExists(target)
+		})
+	}
+	return nil
+}
+
+// Abort undoes a committed transaction, for example because a hook failed,
+// and returns cause together with any error of the rollback.
+func (t *Txn) Abort(cause error) error {
+	var errs []error
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		if err := t.undo[i](); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	t.undo = nil
+	if len(errs) > 0 {
+		t.keep = true
+		return errors.Join(cause, fmt.Errorf("rollback failed, originals kept in %s: %w", t.dir, errors.Join(errs...)))
+	}
+	return cause
+}
+
+// Close removes the staging directory. It is kept when a rollback failed.
+func (t *Txn) Close() error {
+	if t.keep {
+		return nil
+	}
+	return os.RemoveAll(t.dir)
+}
+
+func (t *Txn) path(rel string) string {
+	return filepath.Join(t.root, filepath.FromSlash(rel))
+}
+
+func (t *Txn) stagePath(rel string) string {
+	return filepath.Join(t.dir, "stage", filepath.FromSlash(rel))
+}
+
+// moveAside moves an existing path into the backup area and records how to
+// move it back.
+func (t *Txn) moveAside(rel string) error {
+	target := t.path(rel)
+	if _, err := os.Lstat(target); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	backup := filepath.Join(t.dir, "backup", filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(backup), 0o755); err != nil {
+		return err
+	}
+	if err := os.Rename(target, backup); err != nil {
+		return err
+	}
+	t.undo = append(t.undo, func() error {
+		if err := os.RemoveAll(target); err != nil {
+			return err
+		}
+		return os.Rename(backup, target)
+	})
+	return nil
+}
+
+// mkdirAll creates dir and records the directories it had to create, which
+// are removed again on rollback together with their content.
+func (t *Txn) mkdirAll(dir string) error {
+	var created []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || d == filepath.Dir(d) {
+			break
+		}
+		created = append(created, d)
+	}
+	if len(created) == 0 {
+		return nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	// The outermost directory holds all the others.
+	top := created[len(created)-1]
+	t.undo = append(t.undo, func() error {
+		return os.RemoveAll(top)
+	})
+	return nil
+}
+
+// snapshot records the regular files in dir and how to restore them.
+func (t *Txn) snapshot(rel string) error {
+	dir := t.path(rel)
+	entries, err := os.ReadDir(dir)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	saved := make(map[string][]byte)
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		saved[e.Name()] = data
+	}
+	t.undo = append(t.undo, func() error {
+		entries, err := os.ReadDir(dir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		for _, e := range entries {
+			if _, ok := saved[e.Name()]; !ok && e.Type().IsRegular() {
+				if err := removeIfExists(filepath.Join(dir, e.Name())); err != nil {
+					return err
+				}
+			}
+		}
+		for name, data := range saved {
+			if err := writeContent(filepath.Join(dir, name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return nil
+}
+
+func removeIfExists(p string) error {
+	if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
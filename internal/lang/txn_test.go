@@ -0,0 +1,127 @@
+package lang
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readTree returns the content of every file under root by slash path,
+// leaving out .mm.
+func readTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(root, p)
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if rel == ".mm" {
+				return filepath.SkipDir
+			}
+			if rel != "." {
+				files[rel+"/"] = ""
+			}
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		files[rel] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestTxnAbortRestoresTree(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"go.mod":                       "module shop\n",
+		"services/orders/main.go":      "package main\n",
+		"services/orders/old/stale.go": "package old\n",
+	})
+	before := readTree(t, root)
+
+	txn, err := BeginTxn(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Write("services/orders/main.go", []byte("package main // new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Write("services/users/api/api.go", []byte("package api\n")); err != nil {
+		t.Fatal(err)
+	}
+	txn.Remove("services/orders/old")
+	txn.ProtectFiles(".")
+	if err := txn.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	after := readTree(t, root)
+	if after["services/orders/main.go"] != "package main // new\n" || after["services/users/api/api.go"] != "package api\n" {
+		t.Fatalf("committed tree = %v", after)
+	}
+	if _, ok := after["services/orders/old/"]; ok {
+		t.Fatal("removed directory still exists")
+	}
+
+	// A hook rewrites go.mod and adds go.sum, then fails.
+	writeFiles(t, root, map[string]string{"go.mod": "module shop\n\nrequire x v1\n", "go.sum": "x v1 h1:\n"})
+	hookErr := errors.New("go mod tidy failed")
+	if err := txn.Abort(hookErr); err != hookErr {
+		t.Fatalf("Abort = %v, want the cause", err)
+	}
+	if err := txn.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readTree(t, root); !reflect.DeepEqual(got, before) {
+		t.Errorf("tree after Abort:\n got %v\nwant %v", got, before)
+	}
+	entries, err := os.ReadDir(filepath.Join(root, ".mm"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".txn-") {
+			t.Errorf("staging directory %s left behind", e.Name())
+		}
+	}
+}
+
+func TestTxnCommitFailureRollsBack(t *testing.T) {
+	root := t.TempDir()
+	writeFiles(t, root, map[string]string{
+		"README.md": "# shop\n",
+		"blocker":   "a file where a directory is staged\n",
+	})
+	before := readTree(t, root)
+
+	txn, err := BeginTxn(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer txn.Close()
+	if err := txn.Write("README.md", []byte("# changed\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Write("new/file.txt", []byte("new\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Write("blocker/file.txt", []byte("cannot be written\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := txn.Commit(); err == nil {
+		t.Fatal("Commit succeeded over a file")
+	}
+	if got := readTree(t, root); !reflect.DeepEqual(got, before) {
+		t.Errorf("tree after failed Commit:\n got %v\nwant %v", got, before)
+	}
+}
@@ -0,0 +1,515 @@
+// Package mocks generates programmable fakes of the api.Service interface of
+// Go services, so that the services calling one can be unit tested without
+// running it. The fake is read from the Go code of the api package, so it
+// follows hand-written changes as well as generated ones.
+package mocks
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"micromanager/internal/config"
+	"micromanager/internal/goedit"
+	"micromanager/internal/lang"
+)
+
+// Dir is the package directory of a service's mock, relative to the service.
+const Dir = "mock"
+
+// header starts every generated mock; files without it are never replaced.
+const header = "// Code generated by mm mocks"
+
+// Path returns the repo-relative path of the generated mock of a service.
+func Path(serviceName string) string {
+	return path.Join("services", serviceName, Dir, "service.go")
+}
+
+// Exists reports whether the service has a mock generated by mm.
+func Exists(root, serviceName string) bool {
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(Path(serviceName))))
+	return err == nil && bytes.HasPrefix(data, []byte(header))
+}
+
+// Status tells what Generate did with a mock.
+type Status string
+
+const (
+	StatusCreated   Status = "created"
+	StatusUpdated   Status = "updated"
+	StatusUnchanged Status = "unchanged"
+)
+
+// Result is the outcome for one service.
+type Result struct {
+	Service string
+	Path    string
+	Status  Status
+}
+
+// Generate writes the mock of every named service, or of every service with
+// an api package when names is empty. The mocks are written together, and
+// not at all when one of them fails.
+func Generate(root string, names []string) ([]Result, error) {
+	if len(names) == 0 {
+		all, err := config.ListServices(root)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range all {
+			if hasAPI(root, name) {
+				names = append(names, name)
+			}
+		}
+	}
+
+	t, err := lang.BeginTxn(root)
+	if err != nil {
+		return nil, err
+	}
+	defer t.Close()
+
+	var results []Result
+	var errs []error
+	for _, name := range names {
+		content, err := Build(root, name)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res := Result{Service: name, Path: Path(name), Status: StatusCreated}
+		existing, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(res.Path)))
+		switch {
+		case err == nil && bytes.Equal(existing, content):
+			res.Status = StatusUnchanged
+		case err == nil && !bytes.HasPrefix(existing, []byte(header)):
+			errs = append(errs, fmt.Errorf("%s: not generated by mm mocks, refusing to replace it", res.Path))
+			continue
+		case err == nil:
+			res.Status = StatusUpdated
+		}
+		if res.Status != StatusUnchanged {
+			if err := t.Write(res.Path, content); err != nil {
+				return nil, err
+			}
+		}
+		results = append(results, res)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return results, t.Commit()
+}
+
+func hasAPI(root, name string) bool {
+	cfg, err := config.LoadServiceConfig(root, name)
+	if err != nil || cfg.General.External {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(root, "services", name, "api"))
+	return err == nil && info.IsDir()
+}
+
+// Build returns the gofmt'ed source of the mock of a service, read from the
+// api.Service interface of its api package.
+func Build(root, serviceName string) ([]byte, error) {
+	cfg, err := config.LoadServiceConfig(root, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("load %s config: %w", serviceName, err)
+	}
+	if cfg.General.External {
+		return nil, fmt.Errorf("%s is an external service", serviceName)
+	}
+	if t := cfg.General.Type; t != "" && t != "http" {
+		return nil, fmt.Errorf("%s is a %s service, only http services have an api.Service to mock", serviceName, t)
+	}
+	pkg, err := goedit.LoadPackage(filepath.Join(root, "services", serviceName, "api"))
+	if err != nil {
+		return nil, err
+	}
+	f, spec := pkg.Type("Service")
+	if spec == nil {
+		return nil, fmt.Errorf("%s: no Service interface", pkg.Dir)
+	}
+	iface, ok := spec.Type.(*ast.InterfaceType)
+	if !ok {
+		return nil, fmt.Errorf("%s: Service is not an interface", pkg.Dir)
+	}
+
+	vars := lang.NewTemplateData(root, serviceName, cfg)
+	g := &generator{
+		pkg:     pkg,
+		file:    f,
+		apiPath: path.Join(vars.ProjectName, "services", serviceName, "api"),
+		imports: map[string]string{"errors": "errors", "sync": "sync"},
+	}
+	g.imports["api"] = g.apiPath
+	var methods []method
+	for _, field := range iface.Methods.List {
+		if len(field.Names) == 0 {
+			return nil, fmt.Errorf("%s: embedded interface %s in Service is not supported", pkg.Dir, goedit.Print(field.Type))
+		}
+		fn := field.Type.(*ast.FuncType)
+		for _, n := range field.Names {
+			m, err := g.method(n.Name, fn)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s: %w", pkg.Dir, n.Name, err)
+			}
+			methods = append(methods, m)
+		}
+	}
+	return g.source(serviceName, methods)
+}
+
+// reserved holds the names the generated methods use besides their params.
+var reserved = map[string]bool{"s": true, "fn": true, "fmt": true}
+
+// method is an interface method with its types qualified for the mock package.
+type method struct {
+	Name    string
+	Params  []param
+	Results []string
+}
+
+type param struct {
+	Name     string
+	Type     string
+	Variadic bool
+}
+
+// field returns the name of the param in the Call struct.
+func (p param) field() string {
+	r := []rune(p.Name)
+	r[0] = unicode.ToUpper(r[0])
+	return string(r)
+}
+
+// fieldType returns the type of the param in the Call struct.
+func (p param) fieldType() string {
+	if p.Variadic {
+		return "[]" + p.Type
+	}
+	return p.Type
+}
+
+type generator struct {
+	pkg     *goedit.Package
+	file    *goedit.File
+	apiPath string
+	// imports maps package names used by the mock to import paths.
+	imports map[string]string
+}
+
+func (g *generator) method(name string, fn *ast.FuncType) (method, error) {
+	m := method{Name: name}
+	i := 0
+	for _, field := range fn.Params.List {
+		typ := field.Type
+		variadic := false
+		if e, ok := typ.(*ast.Ellipsis); ok {
+			typ, variadic = e.Elt, true
+		}
+		t, err := g.qualify(typ)
+		if err != nil {
+			return m, err
+		}
+		names := field.Names
+		if len(names) == 0 {
+			names = []*ast.Ident{nil}
+		}
+		for _, n := range names {
+			p := param{Name: fmt.Sprintf("arg%d", i), Type: t, Variadic: variadic}
+			if n != nil && n.Name != "_" && !reserved[n.Name] {
+				p.Name = n.Name
+			}
+			m.Params = append(m.Params, p)
+			i++
+		}
+	}
+	if fn.Results != nil {
+		for _, field := range fn.Results.List {
+			t, err := g.qualify(field.Type)
+			if err != nil {
+				return m, err
+			}
+			for range max(len(field.Names), 1) {
+				m.Results = append(m.Results, t)
+			}
+		}
+	}
+	return m, nil
+}
+
+// qualify prints a type of the api package as seen from the mock package:
+// types declared in api get the api qualifier and the packages of other
+// qualified types are imported.
+func (g *generator) qualify(expr ast.Expr) (string, error) {
+	var err error
+	var walk func(ast.Expr) ast.Expr
+	walk = func(e ast.Expr) ast.Expr {
+		switch e := e.(type) {
+		case *ast.Ident:
+			if g.pkg.Declares(e.Name) {
+				return &ast.SelectorExpr{X: ast.NewIdent("api"), Sel: ast.NewIdent(e.Name)}
+			}
+			return e
+		case *ast.SelectorExpr:
+			if x, ok := e.X.(*ast.Ident); ok {
+				if imp := g.importPath(x.Name); imp != "" {
+					g.imports[x.Name] = imp
+				} else if err == nil {
+					err = fmt.Errorf("unknown package %s", x.Name)
+				}
+			}
+			return e
+		case *ast.StarExpr:
+			return &ast.StarExpr{X: walk(e.X)}
+		case *ast.ArrayType:
+			return &ast.ArrayType{Len: e.Len, Elt: walk(e.Elt)}
+		case *ast.MapType:
+			return &ast.MapType{Key: walk(e.Key), Value: walk(e.Value)}
+		case *ast.ChanType:
+			return &ast.ChanType{Dir: e.Dir, Value: walk(e.Value)}
+		case *ast.Ellipsis:
+			return &ast.Ellipsis{Elt: walk(e.Elt)}
+		case *ast.FuncType, *ast.StructType, *ast.InterfaceType:
+			if err == nil {
+				err = fmt.Errorf("type %s is not supported, declare it in the api package", goedit.Print(e))
+			}
+		}
+		return e
+	}
+	out := goedit.Print(walk(expr))
+	return out, err
+}
+
+// importPath returns the path the api file declaring Service imports under name.
+func (g *generator) importPath(name string) string {
+	for _, imp := range g.file.AST.Imports {
+		p, _ := strconv.Unquote(imp.Path.Value)
+		if g.file.ImportName(p) == name {
+			return p
+		}
+	}
+	return ""
+}
+
+// source renders the mock package.
+func (g *generator) source(serviceName string, methods []method) ([]byte, error) {
+	for _, m := range methods {
+		if hasError(m) {
+			g.imports["fmt"] = "fmt"
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s from services/%s/api. DO NOT EDIT.\n\n", header, serviceName)
+	fmt.Fprintf(&b, "// Package mock provides a programmable fake of the %s service API. It\n", serviceName)
+	fmt.Fprintf(&b, "// records every call and answers with scripted results, so that the services\n")
+	fmt.Fprintf(&b, "// calling %s can be unit tested without running it. Regenerate it with\n", serviceName)
+	fmt.Fprintf(&b, "// mm mocks %s; mm update and mm add endpoint do so when the API changes.\n", serviceName)
+	b.WriteString("package mock\n\n")
+	b.WriteString(g.importBlock())
+	b.WriteString(`
+// ErrNotScripted is returned by methods called without a scripted result.
+var ErrNotScripted = errors.New("mock: no result scripted")
+
+// Service is a fake api.Service. The zero value is ready to use and it is safe
+// for concurrent use.
+type Service struct {
+`)
+	for _, m := range methods {
+		fmt.Fprintf(&b, "\t// %sFunc, when set, answers the calls of %s.\n", m.Name, m.Name)
+		fmt.Fprintf(&b, "\t%sFunc %s\n\n", m.Name, funcType(m, true))
+	}
+	b.WriteString("\tmu sync.Mutex\n")
+	for _, m := range methods {
+		fmt.Fprintf(&b, "\t%sCalls []%sCall\n", lowerFirst(m.Name), m.Name)
+		if len(m.Results) > 0 {
+			fmt.Fprintf(&b, "\t%sScript script[%s]\n", lowerFirst(m.Name), funcType(m, false))
+		}
+	}
+	b.WriteString(`}
+
+var _ api.Service = (*Service)(nil)
+
+// New returns a fake without scripted results.
+func New() *Service {
+	return &Service{}
+}
+`)
+	for _, m := range methods {
+		g.writeMethod(&b, m)
+	}
+	b.WriteString(`
+// script holds the scripted results of a method. They answer one call each,
+// in order, and the last one every call after that.
+type script[F any] struct {
+	results []F
+	// used is set once the last result answered a call.
+	used bool
+}
+
+// add appends a result, replacing a last one that was used already.
+func (s *script[F]) add(f F) {
+	if s.used {
+		s.results, s.used = nil, false
+	}
+	s.results = append(s.results, f)
+}
+
+func (s *script[F]) next() (F, bool) {
+	var f F
+	if len(s.results) == 0 {
+		return f, false
+	}
+	f = s.results[0]
+	if len(s.results) > 1 {
+		s.results = s.results[1:]
+	} else {
+		s.used = true
+	}
+	return f, true
+}
+`)
+	out, err := format.Source([]byte(b.String()))
+	if err != nil {
+		return nil, fmt.Errorf("generated mock of %s does not parse: %w", serviceName, err)
+	}
+	return out, nil
+}
+
+func (g *generator) writeMethod(b *strings.Builder, m method) {
+	lower := lowerFirst(m.Name)
+	var args, fields []string
+	for _, p := range m.Params {
+		arg := p.Name
+		if p.Variadic {
+			arg += "..."
+		}
+		args = append(args, arg)
+		fields = append(fields, p.field()+": "+p.Name)
+	}
+
+	fmt.Fprintf(b, "\n// %sCall is a recorded call of %s.\ntype %sCall struct {\n", m.Name, m.Name, m.Name)
+	for _, p := range m.Params {
+		fmt.Fprintf(b, "\t%s %s\n", p.field(), p.fieldType())
+	}
+	b.WriteString("}\n")
+
+	if len(m.Results) == 0 {
+		fmt.Fprintf(b, "\n// %s records the call and passes it to %sFunc, if set.\n", m.Name, m.Name)
+	} else {
+		fmt.Fprintf(b, "\n// %s records the call. It answers with %sFunc, if set, or\n// else with the next result scripted by Return%s.\n", m.Name, m.Name, m.Name)
+	}
+	fmt.Fprintf(b, "func (s *Service) %s%s {\n", m.Name, strings.TrimPrefix(funcType(m, true), "func"))
+	fmt.Fprintf(b, "\ts.mu.Lock()\n\ts.%sCalls = append(s.%sCalls, %sCall{%s})\n\tfn := s.%sFunc\n", lower, lower, m.Name, strings.Join(fields, ", "), m.Name)
+	if len(m.Results) == 0 {
+		fmt.Fprintf(b, "\ts.mu.Unlock()\n\tif fn != nil {\n\t\tfn(%s)\n\t}\n}\n", strings.Join(args, ", "))
+	} else {
+		fmt.Fprintf(b, "\tif fn == nil {\n\t\tfn, _ = s.%sScript.next()\n\t}\n\ts.mu.Unlock()\n\tif fn == nil {\n", lower)
+		var zeros []string
+		for i, r := range m.Results {
+			if r == "error" && i == len(m.Results)-1 {
+				zeros = append(zeros, fmt.Sprintf("fmt.Errorf(\"%%w for %s\", ErrNotScripted)", m.Name))
+				continue
+			}
+			fmt.Fprintf(b, "\t\tvar r%d %s\n", i, r)
+			zeros = append(zeros, fmt.Sprintf("r%d", i))
+		}
+		fmt.Fprintf(b, "\t\treturn %s\n\t}\n\treturn fn(%s)\n}\n", strings.Join(zeros, ", "), strings.Join(args, ", "))
+
+		var results, names []string
+		for i, r := range m.Results {
+			name := fmt.Sprintf("r%d", i)
+			if r == "error" && i == len(m.Results)-1 {
+				name = "err"
+			}
+			names = append(names, name)
+			results = append(results, name+" "+r)
+		}
+		fmt.Fprintf(b, "\n// Return%s scripts the result of the next call of %s.\n// Results answer one call each, in order, and the last one every call after\n// that.\n", m.Name, m.Name)
+		fmt.Fprintf(b, "func (s *Service) Return%s(%s) *Service {\n", m.Name, strings.Join(results, ", "))
+		fmt.Fprintf(b, "\ts.mu.Lock()\n\tdefer s.mu.Unlock()\n\ts.%sScript.add(%s {\n\t\treturn %s\n\t})\n\treturn s\n}\n",
+			lower, funcType(m, false), strings.Join(names, ", "))
+	}
+
+	fmt.Fprintf(b, "\n// %sCalls returns the calls of %s so far.\n", m.Name, m.Name)
+	fmt.Fprintf(b, "func (s *Service) %sCalls() []%sCall {\n\ts.mu.Lock()\n\tdefer s.mu.Unlock()\n\treturn append([]%sCall(nil), s.%sCalls...)\n}\n",
+		m.Name, m.Name, m.Name, lower)
+}
+
+// importBlock returns the import declaration of the mock package, with the
+// standard library first.
+func (g *generator) importBlock() string {
+	var std, other []string
+	for name, p := range g.imports {
+		spec := strconv.Quote(p)
+		if name != p[strings.LastIndex(p, "/")+1:] {
+			spec = name + " " + spec
+		}
+		if first, _, _ := strings.Cut(p, "/"); strings.Contains(first, ".") || p == g.apiPath {
+			other = append(other, spec)
+		} else {
+			std = append(std, spec)
+		}
+	}
+	sort.Strings(std)
+	sort.Strings(other)
+	var b strings.Builder
+	b.WriteString("import (\n")
+	for _, s := range std {
+		b.WriteString("\t" + s + "\n")
+	}
+	if len(std) > 0 && len(other) > 0 {
+		b.WriteString("\n")
+	}
+	for _, s := range other {
+		b.WriteString("\t" + s + "\n")
+	}
+	b.WriteString(")\n")
+	return b.String()
+}
+
+// funcType returns the func type of a method, with parameter names if named.
+func funcType(m method, named bool) string {
+	var params []string
+	for _, p := range m.Params {
+		t := p.Type
+		if p.Variadic {
+			t = "..." + t
+		}
+		if named {
+			t = p.Name + " " + t
+		}
+		params = append(params, t)
+	}
+	s := "func(" + strings.Join(params, ", ") + ")"
+	switch len(m.Results) {
+	case 0:
+	case 1:
+		s += " " + m.Results[0]
+	default:
+		s += " (" + strings.Join(m.Results, ", ") + ")"
+	}
+	return s
+}
+
+func hasError(m method) bool {
+	return len(m.Results) > 0 && m.Results[len(m.Results)-1] == "error"
+}
+
+func lowerFirst(s string) string {
+	r := []rune(s)
+	r[0] = unicode.ToLower(r[0])
+	return string(r)
+}
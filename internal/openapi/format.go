@@ -0,0 +1,34 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats supported by Write.
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// Write encodes the document in the given format.
+func Write(w io.Writer, doc *Document, format string) error {
+	switch format {
+	case FormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(doc); err != nil {
+			return err
+		}
+		return enc.Close()
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(doc)
+	default:
+		return fmt.Errorf("unknown OpenAPI format %q (yaml, json)", format)
+	}
+}
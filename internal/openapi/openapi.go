@@ -0,0 +1,455 @@
+// Package openapi builds OpenAPI 3.1 documents from the Go source of a
+// service: the operations of its api.Service interface, the routes that call
+// them in NewRouter and the struct tags of the API types.
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+
+	"micromanager/internal/config"
+	"micromanager/internal/goedit"
+)
+
+// Version is the OpenAPI version of generated documents.
+const Version = "3.1.0"
+
+// Document is an OpenAPI document, limited to what services generate.
+type Document struct {
+	OpenAPI    string              `json:"openapi" yaml:"openapi"`
+	Info       Info                `json:"info" yaml:"info"`
+	Paths      map[string]PathItem `json:"paths" yaml:"paths"`
+	Components Components          `json:"components" yaml:"components"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title   string `json:"title" yaml:"title"`
+	Version string `json:"version" yaml:"version"`
+}
+
+// PathItem holds the operations of a path by lower-case HTTP method.
+type PathItem map[string]*Operation
+
+// Operation is a single route.
+type Operation struct {
+	OperationID string              `json:"operationId" yaml:"operationId"`
+	Summary     string              `json:"summary,omitempty" yaml:"summary,omitempty"`
+	Description string              `json:"description,omitempty" yaml:"description,omitempty"`
+	Tags        []string            `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty" yaml:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses" yaml:"responses"`
+}
+
+// Parameter is a path or query parameter.
+type Parameter struct {
+	Name        string  `json:"name" yaml:"name"`
+	In          string  `json:"in" yaml:"in"`
+	Description string  `json:"description,omitempty" yaml:"description,omitempty"`
+	Required    bool    `json:"required,omitempty" yaml:"required,omitempty"`
+	Schema      *Schema `json:"schema" yaml:"schema"`
+}
+
+// RequestBody is the JSON body of an operation.
+type RequestBody struct {
+	Required bool                 `json:"required" yaml:"required"`
+	Content  map[string]MediaType `json:"content" yaml:"content"`
+}
+
+// Response is a response by status code.
+type Response struct {
+	Description string               `json:"description" yaml:"description"`
+	Content     map[string]MediaType `json:"content,omitempty" yaml:"content,omitempty"`
+}
+
+// MediaType holds the schema of a body.
+type MediaType struct {
+	Schema *Schema `json:"schema" yaml:"schema"`
+}
+
+// Components holds the schemas of the API types by name.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas" yaml:"schemas"`
+}
+
+// Schema is a JSON Schema as used by OpenAPI 3.1. Type is a string, or a list
+// of strings for nullable types.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string             `json:"format,omitempty" yaml:"format,omitempty"`
+	Description          string             `json:"description,omitempty" yaml:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty" yaml:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	AnyOf                []*Schema          `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
+	Enum                 []any              `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+}
+
+// Options customizes Build.
+type Options struct {
+	// Version is the info.version of the document, "1.0.0" when empty.
+	Version string
+}
+
+// errorSchema is the body of 4xx and 5xx responses of the router.
+const errorSchema = "Error"
+
+// Build reads the api and server packages of a service and returns its
+// OpenAPI document. Only routes whose handler calls a method of api.Service
+// are included. The api package is type-checked with go/packages, so types
+// declared in other packages are described as well; the routes are read from
+// the syntax of the server package.
+func Build(root, serviceName string, opts Options) (*Document, error) {
+	cfg, err := config.LoadServiceConfig(root, serviceName)
+	if err != nil {
+		return nil, fmt.Errorf("load %s config: %w", serviceName, err)
+	}
+	if cfg.General.External {
+		return nil, fmt.Errorf("%s is an external service", serviceName)
+	}
+	if t := cfg.General.Type; t != "" && t != "http" {
+		return nil, fmt.Errorf("%s is a %s service, only http services have an OpenAPI document", serviceName, t)
+	}
+	dir := filepath.Join(root, "services", serviceName)
+	api, err := loadTypes(dir, "./api")
+	if err != nil {
+		return nil, err
+	}
+	server, err := goedit.LoadPackage(filepath.Join(dir, "server"))
+	if err != nil {
+		return nil, err
+	}
+
+	methods, err := serviceMethods(api)
+	if err != nil {
+		return nil, err
+	}
+	routes, err := findRoutes(server, methods)
+	if err != nil {
+		return nil, err
+	}
+
+	version := opts.Version
+	if version == "" {
+		version = "1.0.0"
+	}
+	doc := &Document{
+		OpenAPI: Version,
+		Info:    Info{Title: serviceName, Version: version},
+		Paths:   make(map[string]PathItem),
+		Components: Components{Schemas: map[string]*Schema{
+			errorSchema: {
+				Type:       "object",
+				Properties: map[string]*Schema{"error": {Type: "string"}},
+				Required:   []string{"error"},
+			},
+		}},
+	}
+	s := newSchemas(api, doc.Components.Schemas)
+	for _, r := range routes {
+		op, err := s.operation(r, serviceName)
+		if err != nil {
+			return nil, err
+		}
+		path := openAPIPath(r.path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(PathItem)
+		}
+		doc.Paths[path][strings.ToLower(r.httpMethod)] = op
+	}
+	return doc, nil
+}
+
+// loadTypes loads and type-checks the package matching pattern in dir.
+func loadTypes(dir, pattern string) (*packages.Package, error) {
+	cfg := &packages.Config{
+		// Dependencies are type-checked from source as well, which does not
+		// depend on the export data format of the installed Go.
+		Mode: packages.NeedName | packages.NeedImports | packages.NeedDeps | packages.NeedTypes | packages.NeedSyntax | packages.NeedTypesInfo,
+		Dir:  dir,
+	}
+	pkgs, err := packages.Load(cfg, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("load %s: %w", filepath.Join(dir, pattern), err)
+	}
+	if len(pkgs) != 1 {
+		return nil, fmt.Errorf("load %s: found %d packages", filepath.Join(dir, pattern), len(pkgs))
+	}
+	var errs []error
+	for _, e := range pkgs[0].Errors {
+		errs = append(errs, e)
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	return pkgs[0], nil
+}
+
+// method is an operation of api.Service.
+type method struct {
+	name     string
+	doc      string
+	request  types.Type
+	response types.Type
+}
+
+// serviceMethods returns the methods of api.Service by name.
+func serviceMethods(api *packages.Package) (map[string]method, error) {
+	obj := api.Types.Scope().Lookup("Service")
+	if obj == nil {
+		return nil, fmt.Errorf("%s: no Service interface", api.PkgPath)
+	}
+	iface, ok := obj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return nil, fmt.Errorf("%s: Service is not an interface", api.PkgPath)
+	}
+	docs := fieldDocs(api)
+	methods := make(map[string]method)
+	for i := range iface.NumMethods() {
+		fn := iface.Method(i)
+		sig := fn.Type().(*types.Signature)
+		m := method{name: fn.Name(), doc: docs[fn.Pos()]}
+		// The first parameter is the context.
+		if sig.Params().Len() > 1 {
+			m.request = sig.Params().At(1).Type()
+		}
+		if sig.Results().Len() == 2 {
+			m.response = sig.Results().At(0).Type()
+			if ptr, ok := m.response.(*types.Pointer); ok {
+				m.response = ptr.Elem()
+			}
+		}
+		methods[m.name] = m
+	}
+	return methods, nil
+}
+
+// route is a route of NewRouter and the service method its handler calls.
+type route struct {
+	httpMethod string
+	path       string
+	method     method
+}
+
+var httpMethods = map[string]bool{"GET": true, "POST": true, "PUT": true, "PATCH": true, "DELETE": true}
+
+// findRoutes follows the route groups of NewRouter to the full path of every
+// route calling a service method.
+func findRoutes(server *goedit.Package, methods map[string]method) ([]route, error) {
+	_, fn := server.Func("NewRouter")
+	if fn == nil || fn.Body == nil {
+		return nil, fmt.Errorf("%s: no NewRouter function", server.Dir)
+	}
+	var service string
+	for _, field := range fn.Type.Params.List {
+		if goedit.Print(field.Type) == "api.Service" && len(field.Names) == 1 {
+			service = field.Names[0].Name
+		}
+	}
+	if service == "" {
+		return nil, fmt.Errorf("%s: NewRouter takes no api.Service", server.Dir)
+	}
+
+	prefixes := make(map[string]string)
+	var routes []route
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Lhs) != 1 || len(n.Rhs) != 1 {
+				return true
+			}
+			recv, name, args := selectorCall(n.Rhs[0])
+			lhs, ok := n.Lhs[0].(*ast.Ident)
+			if name == "Group" && ok && len(args) > 0 {
+				if p, ok := stringLit(args[0]); ok {
+					prefixes[lhs.Name] = joinRoute(prefixes[recv], p)
+				}
+			}
+		case *ast.CallExpr:
+			recv, name, args := selectorCall(n)
+			if !httpMethods[name] || len(args) < 2 {
+				return true
+			}
+			p, ok := stringLit(args[0])
+			if !ok {
+				return true
+			}
+			if m, ok := calledMethod(args[1:], service, methods); ok {
+				routes = append(routes, route{httpMethod: name, path: joinRoute(prefixes[recv], p), method: m})
+			}
+			return false
+		}
+		return true
+	})
+	return routes, nil
+}
+
+// calledMethod returns the service method called by a route's handlers.
+func calledMethod(handlers []ast.Expr, service string, methods map[string]method) (method, bool) {
+	var found method
+	var ok bool
+	for _, h := range handlers {
+		ast.Inspect(h, func(n ast.Node) bool {
+			recv, name, _ := selectorCall(n)
+			if m, known := methods[name]; known && recv == service && !ok {
+				found, ok = m, true
+			}
+			return !ok
+		})
+	}
+	return found, ok
+}
+
+// selectorCall splits a call x.name(args) with an identifier x.
+func selectorCall(n ast.Node) (recv, name string, args []ast.Expr) {
+	call, ok := n.(*ast.CallExpr)
+	if !ok {
+		return "", "", nil
+	}
+	sel, ok := call.Fun.(*ast.SelectorExpr)
+	if !ok {
+		return "", "", nil
+	}
+	if id, ok := sel.X.(*ast.Ident); ok {
+		recv = id.Name
+	}
+	return recv, sel.Sel.Name, call.Args
+}
+
+func stringLit(x ast.Expr) (string, bool) {
+	lit, ok := x.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return s, err == nil
+}
+
+// joinRoute joins route paths as gin does.
+func joinRoute(prefix, p string) string {
+	if p == "" || p == "/" {
+		if prefix == "" {
+			return "/"
+		}
+		return prefix
+	}
+	return strings.TrimRight(prefix, "/") + "/" + strings.TrimLeft(p, "/")
+}
+
+// openAPIPath writes gin's :name and *name segments as {name}.
+func openAPIPath(route string) string {
+	segments := strings.Split(route, "/")
+	for i, seg := range segments {
+		if strings.HasPrefix(seg, ":") || strings.HasPrefix(seg, "*") {
+			segments[i] = "{" + seg[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// operation describes a route. Request fields tagged uri are path parameters,
+// fields tagged form are query parameters of requests without a body, and
+// the request is the JSON body of every other method.
+func (s *schemas) operation(r route, tag string) (*Operation, error) {
+	op := &Operation{
+		OperationID: r.method.name,
+		Tags:        []string{tag},
+		Responses:   make(map[string]Response),
+	}
+	if r.method.doc != "" {
+		summary, rest, _ := strings.Cut(r.method.doc, "\n")
+		op.Summary = summary
+		op.Description = strings.TrimSpace(rest)
+	}
+
+	inPath := make(map[string]bool)
+	if r.method.request != nil {
+		fields, err := s.fields(r.method.request)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.method.name, err)
+		}
+		body := r.httpMethod != "GET" && r.httpMethod != "DELETE"
+		for _, f := range fields {
+			switch {
+			case f.tags.Get("uri") != "":
+				name := tagName(f.tags.Get("uri"))
+				inPath[name] = true
+				op.Parameters = append(op.Parameters, Parameter{Name: name, In: "path", Required: true, Description: f.doc, Schema: f.schema})
+			case !body && f.tags.Get("form") != "" && tagName(f.tags.Get("form")) != "-":
+				op.Parameters = append(op.Parameters, Parameter{Name: tagName(f.tags.Get("form")), In: "query", Required: f.required, Description: f.doc, Schema: f.schema})
+			}
+		}
+		if body {
+			schema, err := s.schema(r.method.request)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", r.method.name, err)
+			}
+			op.RequestBody = &RequestBody{Required: true, Content: jsonContent(schema)}
+		}
+		op.Responses["400"] = Response{Description: "Invalid request", Content: jsonContent(&Schema{Ref: ref(errorSchema)})}
+	}
+	// Every parameter of the path must be declared.
+	for _, seg := range strings.Split(r.path, "/") {
+		if len(seg) > 1 && (seg[0] == ':' || seg[0] == '*') && !inPath[seg[1:]] {
+			op.Parameters = append(op.Parameters, Parameter{Name: seg[1:], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	if r.method.response != nil {
+		schema, err := s.schema(r.method.response)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", r.method.name, err)
+		}
+		op.Responses["200"] = Response{Description: "OK", Content: jsonContent(schema)}
+	} else {
+		op.Responses["204"] = Response{Description: "No content"}
+	}
+	op.Responses["500"] = Response{Description: "Internal error", Content: jsonContent(&Schema{Ref: ref(errorSchema)})}
+	return op, nil
+}
+
+// nullable allows null in addition to a schema.
+func nullable(s *Schema) *Schema {
+	if t, ok := s.Type.(string); ok && s.Ref == "" {
+		s.Type = []string{t, "null"}
+		return s
+	}
+	if s.Ref == "" && s.Type == nil {
+		return s
+	}
+	return &Schema{AnyOf: []*Schema{s, {Type: "null"}}}
+}
+
+func ref(name string) string {
+	return "#/components/schemas/" + name
+}
+
+func jsonContent(s *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: s}}
+}
+
+// tagName returns the name part of a struct tag value.
+func tagName(tag string) string {
+	name, _, _ := strings.Cut(tag, ",")
+	return name
+}
@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTree writes files relative to dir.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// newService writes a module with the service orders whose api package
+// holds apiSrc. The server package is only parsed, so it needs no router.
+func newService(t *testing.T, apiSrc string) string {
+	t.Helper()
+	root := t.TempDir()
+	writeTree(t, root, map[string]string{
+		"go.mod":                       "module shop\n\ngo 1.22\n",
+		"services/orders/service.toml": "[general]\nlang = \"go\"\n",
+		"services/orders/api/api.go":   apiSrc,
+		"services/orders/server/router.go": `package server
+
+import "shop/services/orders/api"
+
+func NewRouter(svc api.Service) *Router {
+	r := newRouter()
+	g := r.Group("/orders")
+	g.POST("", func(c *Context) { svc.CreateOrder(c, api.Order{}) })
+	return r
+}
+`,
+		"common/money/money.go": `package money
+
+// Money is an amount in a currency.
+type Money struct {
+	Cents    int64  ` + "`json:\"cents\"`" + `
+	Currency string ` + "`json:\"currency\"`" + `
+}
+
+// Meta is embedded by API types.
+type Meta struct {
+	Version int ` + "`json:\"version\"`" + `
+}
+`,
+	})
+	return root
+}
+
+func TestBuildResolvesTypes(t *testing.T) {
+	root := newService(t, `package api
+
+import (
+	"context"
+
+	"shop/common/money"
+)
+
+type Service interface {
+	// CreateOrder places an order.
+	CreateOrder(ctx context.Context, req Order) (*Order, error)
+}
+
+type Base struct {
+	ID string `+"`json:\"id\"`"+`
+}
+
+// Order is an order.
+type Order struct {
+	*Base
+	money.Meta
+	// Total is the amount due.
+	Total money.Money `+"`json:\"total\" binding:\"required\"`"+`
+	Note  string      `+"`json:\"note\"`"+`
+	internal string
+}
+`)
+	doc, err := Build(root, "orders", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op := doc.Paths["/orders"]["post"]
+	if op == nil || op.Summary != "CreateOrder places an order." {
+		t.Fatalf("POST /orders = %+v", op)
+	}
+	order := doc.Components.Schemas["Order"]
+	if order == nil {
+		t.Fatal("no Order schema")
+	}
+	var props []string
+	for name := range order.Properties {
+		props = append(props, name)
+	}
+	for _, want := range []string{"id", "version", "total", "note"} {
+		if order.Properties[want] == nil {
+			t.Errorf("Order properties %v lack %s", props, want)
+		}
+	}
+	if len(order.Properties) != 4 {
+		t.Errorf("Order properties = %v, want 4", props)
+	}
+	if got := order.Properties["total"]; got.Ref != ref("Money") || got.Description != "Total is the amount due." {
+		t.Errorf("total = %+v", got)
+	}
+	if !reflect.DeepEqual(order.Required, []string{"total"}) {
+		t.Errorf("required = %v", order.Required)
+	}
+	money := doc.Components.Schemas["Money"]
+	if money == nil || money.Properties["cents"] == nil || money.Properties["currency"] == nil {
+		t.Errorf("Money = %+v", money)
+	}
+}
+
+func TestBuildRejectsUnresolvedTypes(t *testing.T) {
+	root := newService(t, `package api
+
+import "context"
+
+type Service interface {
+	CreateOrder(ctx context.Context, req Order) (*Order, error)
+}
+
+type Order struct {
+	Customer Customer
+}
+`)
+	_, err := Build(root, "orders", Options{})
+	if err == nil || !strings.Contains(err.Error(), "Customer") {
+		t.Fatalf("Build error = %v, want an undefined Customer", err)
+	}
+}
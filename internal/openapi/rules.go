@@ -0,0 +1,158 @@
+package openapi
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Formats of validator rules that are plain string formats.
+var ruleFormats = map[string]string{
+	"email":    "email",
+	"url":      "uri",
+	"http_url": "uri",
+	"uri":      "uri",
+	"uuid":     "uuid",
+	"uuid4":    "uuid",
+	"ipv4":     "ipv4",
+	"ipv6":     "ipv6",
+	"hostname": "hostname",
+	"datetime": "date-time",
+}
+
+// Patterns of validator rules checking the characters of a string.
+var rulePatterns = map[string]string{
+	"alpha":    "^[a-zA-Z]+$",
+	"alphanum": "^[a-zA-Z0-9]+$",
+	"numeric":  "^[-+]?[0-9]+(?:\\.[0-9]+)?$",
+	"number":   "^[0-9]+$",
+}
+
+// applyRules maps the validator rules of a binding or validate tag, such as
+// "required,min=1,dive,email", onto a schema and reports whether the field
+// is required. Rules after dive apply to the elements. Rules without an
+// equivalent, including alternatives joined with |, are left out.
+func applyRules(s *Schema, rules string) bool {
+	required := false
+	target := s
+	inKeys := false
+	for _, rule := range strings.Split(rules, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch {
+		case name == "keys":
+			inKeys = true
+			continue
+		case name == "endkeys":
+			inKeys = false
+			continue
+		case inKeys || target == nil || strings.Contains(name, "|"):
+			continue
+		}
+
+		switch name {
+		case "required":
+			required = required || target == s
+		case "dive":
+			switch {
+			case target.Items != nil:
+				target = target.Items
+			case target.AdditionalProperties != nil:
+				target = target.AdditionalProperties
+			default:
+				target = nil
+			}
+		case "min", "gte":
+			setBound(target, param, false, false)
+		case "gt":
+			setBound(target, param, false, true)
+		case "max", "lte":
+			setBound(target, param, true, false)
+		case "lt":
+			setBound(target, param, true, true)
+		case "len":
+			setBound(target, param, false, false)
+			setBound(target, param, true, false)
+		case "oneof":
+			if target.Ref != "" {
+				continue
+			}
+			target.Enum = nil
+			for _, v := range strings.Fields(param) {
+				target.Enum = append(target.Enum, enumValue(target, v))
+			}
+		default:
+			if f, ok := ruleFormats[name]; ok && baseType(target) == "string" {
+				target.Format = f
+			} else if p, ok := rulePatterns[name]; ok && baseType(target) == "string" {
+				target.Pattern = p
+			}
+		}
+	}
+	return required
+}
+
+// setBound sets a limit on the length of strings and arrays or on the value
+// of numbers. Exclusive limits on lengths are turned into inclusive ones.
+func setBound(s *Schema, param string, upper, exclusive bool) {
+	v, err := strconv.ParseFloat(param, 64)
+	if err != nil {
+		return
+	}
+	switch baseType(s) {
+	case "integer", "number":
+		switch {
+		case upper && exclusive:
+			s.ExclusiveMaximum = &v
+		case upper:
+			s.Maximum = &v
+		case exclusive:
+			s.ExclusiveMinimum = &v
+		default:
+			s.Minimum = &v
+		}
+	case "string", "array":
+		n := int(v)
+		if exclusive && upper {
+			n--
+		} else if exclusive {
+			n++
+		}
+		switch {
+		case baseType(s) == "string" && upper:
+			s.MaxLength = &n
+		case baseType(s) == "string":
+			s.MinLength = &n
+		case upper:
+			s.MaxItems = &n
+		default:
+			s.MinItems = &n
+		}
+	}
+}
+
+// baseType returns the type of a schema, ignoring null.
+func baseType(s *Schema) string {
+	switch t := s.Type.(type) {
+	case string:
+		return t
+	case []string:
+		if len(t) > 0 {
+			return t[0]
+		}
+	}
+	return ""
+}
+
+// enumValue converts a oneof value to the type of the schema.
+func enumValue(s *Schema, v string) any {
+	switch baseType(s) {
+	case "integer":
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+	case "number":
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			return f
+		}
+	}
+	return v
+}
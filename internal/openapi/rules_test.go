@@ -0,0 +1,169 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyRules(t *testing.T) {
+	num := func(v float64) *float64 { return &v }
+	n := func(v int) *int { return &v }
+	tests := []struct {
+		name     string
+		schema   Schema
+		rules    string
+		want     Schema
+		required bool
+	}{
+		{
+			name:     "string length",
+			schema:   Schema{Type: "string"},
+			rules:    "required,min=1,max=64",
+			want:     Schema{Type: "string", MinLength: n(1), MaxLength: n(64)},
+			required: true,
+		},
+		{
+			name:   "string len",
+			schema: Schema{Type: "string"},
+			rules:  "len=2",
+			want:   Schema{Type: "string", MinLength: n(2), MaxLength: n(2)},
+		},
+		{
+			name:   "string exclusive length",
+			schema: Schema{Type: "string"},
+			rules:  "gt=0,lt=10",
+			want:   Schema{Type: "string", MinLength: n(1), MaxLength: n(9)},
+		},
+		{
+			name:   "nullable string",
+			schema: Schema{Type: []string{"string", "null"}},
+			rules:  "omitempty,gte=3,lte=5",
+			want:   Schema{Type: []string{"string", "null"}, MinLength: n(3), MaxLength: n(5)},
+		},
+		{
+			name:   "array length",
+			schema: Schema{Type: "array", Items: &Schema{Type: "string"}},
+			rules:  "min=1,max=10",
+			want:   Schema{Type: "array", Items: &Schema{Type: "string"}, MinItems: n(1), MaxItems: n(10)},
+		},
+		{
+			name:   "array len",
+			schema: Schema{Type: "array", Items: &Schema{Type: "integer"}},
+			rules:  "len=3",
+			want:   Schema{Type: "array", Items: &Schema{Type: "integer"}, MinItems: n(3), MaxItems: n(3)},
+		},
+		{
+			name:   "number bounds",
+			schema: Schema{Type: "number"},
+			rules:  "min=0.5,max=99.5",
+			want:   Schema{Type: "number", Minimum: num(0.5), Maximum: num(99.5)},
+		},
+		{
+			name:   "integer exclusive bounds",
+			schema: Schema{Type: "integer"},
+			rules:  "gt=0,lt=100",
+			want:   Schema{Type: "integer", ExclusiveMinimum: num(0), ExclusiveMaximum: num(100)},
+		},
+		{
+			name:   "integer len",
+			schema: Schema{Type: "integer"},
+			rules:  "len=7",
+			want:   Schema{Type: "integer", Minimum: num(7), Maximum: num(7)},
+		},
+		{
+			name:   "bad bound",
+			schema: Schema{Type: "integer"},
+			rules:  "min=abc",
+			want:   Schema{Type: "integer"},
+		},
+		{
+			name:   "string oneof",
+			schema: Schema{Type: "string"},
+			rules:  "oneof=new paid shipped",
+			want:   Schema{Type: "string", Enum: []any{"new", "paid", "shipped"}},
+		},
+		{
+			name:   "integer oneof",
+			schema: Schema{Type: "integer"},
+			rules:  "oneof=1 2 3",
+			want:   Schema{Type: "integer", Enum: []any{int64(1), int64(2), int64(3)}},
+		},
+		{
+			name:   "number oneof",
+			schema: Schema{Type: "number"},
+			rules:  "oneof=0.5 1",
+			want:   Schema{Type: "number", Enum: []any{0.5, 1.0}},
+		},
+		{
+			name:   "oneof on a reference",
+			schema: Schema{Ref: ref("Status")},
+			rules:  "oneof=a b",
+			want:   Schema{Ref: ref("Status")},
+		},
+		{
+			name:     "dive into slice elements",
+			schema:   Schema{Type: "array", Items: &Schema{Type: "string"}},
+			rules:    "required,max=5,dive,required,email,max=254",
+			want:     Schema{Type: "array", MaxItems: n(5), Items: &Schema{Type: "string", Format: "email", MaxLength: n(254)}},
+			required: true,
+		},
+		{
+			name:   "dive into map values",
+			schema: Schema{Type: "object", AdditionalProperties: &Schema{Type: "integer"}},
+			rules:  "dive,keys,min=1,endkeys,gte=0",
+			want:   Schema{Type: "object", AdditionalProperties: &Schema{Type: "integer", Minimum: num(0)}},
+		},
+		{
+			name:   "dive past the elements",
+			schema: Schema{Type: "array", Items: &Schema{Type: "string"}},
+			rules:  "dive,dive,min=1",
+			want:   Schema{Type: "array", Items: &Schema{Type: "string"}},
+		},
+		{
+			name:   "email",
+			schema: Schema{Type: "string"},
+			rules:  "email",
+			want:   Schema{Type: "string", Format: "email"},
+		},
+		{
+			name:     "uuid",
+			schema:   Schema{Type: "string"},
+			rules:    "required,uuid4",
+			want:     Schema{Type: "string", Format: "uuid"},
+			required: true,
+		},
+		{
+			name:   "format on a non-string",
+			schema: Schema{Type: "integer"},
+			rules:  "uuid",
+			want:   Schema{Type: "integer"},
+		},
+		{
+			name:   "pattern",
+			schema: Schema{Type: "string"},
+			rules:  "alphanum",
+			want:   Schema{Type: "string", Pattern: "^[a-zA-Z0-9]+$"},
+		},
+		{
+			name:   "alternatives are left out",
+			schema: Schema{Type: "string"},
+			rules:  "email|uuid,max=10",
+			want:   Schema{Type: "string", MaxLength: n(10)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.schema
+			required := applyRules(&s, tt.rules)
+			if required != tt.required {
+				t.Errorf("required = %v, want %v", required, tt.required)
+			}
+			if !reflect.DeepEqual(s, tt.want) {
+				got, _ := json.Marshal(s)
+				want, _ := json.Marshal(tt.want)
+				t.Errorf("schema = %s, want %s", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,311 @@
+package openapi
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// schemas converts Go types to schemas, adding the named types to the
+// components as they are referenced.
+type schemas struct {
+	components map[string]*Schema
+	// named holds the type behind every component added, so that two types
+	// of the same name in different packages are not merged.
+	named map[string]*types.TypeName
+	// docs holds doc comments by the position of the declared name.
+	docs map[token.Pos]string
+}
+
+func newSchemas(api *packages.Package, components map[string]*Schema) *schemas {
+	return &schemas{
+		components: components,
+		named:      make(map[string]*types.TypeName),
+		docs:       fieldDocs(api),
+	}
+}
+
+// fieldDocs returns the doc comments of the type declarations, struct
+// fields and interface methods of a package by the position of their name.
+// Embedded fields are found by the position of their type.
+func fieldDocs(pkg *packages.Package) map[token.Pos]string {
+	docs := make(map[token.Pos]string)
+	for _, f := range pkg.Syntax {
+		ast.Inspect(f, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.GenDecl:
+				if n.Tok == token.TYPE && len(n.Specs) == 1 && n.Doc != nil {
+					docs[n.Specs[0].(*ast.TypeSpec).Name.Pos()] = strings.TrimSpace(n.Doc.Text())
+				}
+			case *ast.TypeSpec:
+				if n.Doc != nil {
+					docs[n.Name.Pos()] = strings.TrimSpace(n.Doc.Text())
+				}
+			case *ast.Field:
+				doc := strings.TrimSpace(n.Doc.Text())
+				if doc == "" {
+					doc = strings.TrimSpace(n.Comment.Text())
+				}
+				if doc == "" {
+					return true
+				}
+				if len(n.Names) == 0 {
+					docs[embeddedPos(n.Type)] = doc
+				}
+				for _, name := range n.Names {
+					docs[name.Pos()] = doc
+				}
+			}
+			return true
+		})
+	}
+	return docs
+}
+
+// embeddedPos returns the position go/types gives an embedded field: that
+// of the type name, after any * and package qualifier.
+func embeddedPos(expr ast.Expr) token.Pos {
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if sel, ok := expr.(*ast.SelectorExpr); ok {
+		return sel.Sel.Pos()
+	}
+	return expr.Pos()
+}
+
+// field is an exported struct field as encoded in JSON.
+type field struct {
+	name     string
+	doc      string
+	tags     reflect.StructTag
+	schema   *Schema
+	required bool
+}
+
+// fields returns the fields of a struct type, with embedded structs
+// flattened as encoding/json does: fields of the outer struct win over
+// embedded fields of the same name.
+func (s *schemas) fields(t types.Type) ([]field, error) {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil, nil
+	}
+
+	var fields, embedded []field
+	for i := range st.NumFields() {
+		f := st.Field(i)
+		tags := reflect.StructTag(st.Tag(i))
+		jsonName, opts, _ := strings.Cut(tags.Get("json"), ",")
+		if jsonName == "-" && opts == "" {
+			continue
+		}
+		if f.Embedded() && jsonName == "" {
+			elem := f.Type()
+			if ptr, ok := elem.(*types.Pointer); ok {
+				elem = ptr.Elem()
+			}
+			if _, isStruct := elem.Underlying().(*types.Struct); isStruct {
+				inner, err := s.fields(elem)
+				if err != nil {
+					return nil, fmt.Errorf("field %s: %w", f.Name(), err)
+				}
+				embedded = append(embedded, inner...)
+				continue
+			}
+		}
+		if !f.Exported() {
+			continue
+		}
+		schema, err := s.schema(f.Type())
+		if err != nil {
+			return nil, fmt.Errorf("field %s: %w", f.Name(), err)
+		}
+		name := jsonName
+		if name == "" {
+			name = f.Name()
+		}
+		required := applyRules(schema, tags.Get("binding"))
+		required = applyRules(schema, tags.Get("validate")) || required
+		fields = append(fields, field{name: name, doc: s.docs[f.Pos()], tags: tags, schema: schema, required: required})
+	}
+
+	declared := make(map[string]bool, len(fields))
+	for _, f := range fields {
+		declared[f.name] = true
+	}
+	for _, f := range embedded {
+		if !declared[f.name] {
+			declared[f.name] = true
+			fields = append(fields, f)
+		}
+	}
+	return fields, nil
+}
+
+// schema returns the schema of a type. Named types are referenced from the
+// components.
+func (s *schemas) schema(t types.Type) (*Schema, error) {
+	if named, ok := t.(*types.Named); ok {
+		return s.namedSchema(named)
+	}
+	switch t := t.(type) {
+	case *types.Alias:
+		return s.schema(types.Unalias(t))
+	case *types.Basic:
+		if schema, ok := basicSchema(t); ok {
+			return schema, nil
+		}
+	case *types.Pointer:
+		elem, err := s.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return nullable(elem), nil
+	case *types.Slice:
+		return s.array(t.Elem())
+	case *types.Array:
+		return s.array(t.Elem())
+	case *types.Map:
+		values, err := s.schema(t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return &Schema{Type: "object", AdditionalProperties: values}, nil
+	case *types.Struct:
+		return s.object(t)
+	case *types.Interface:
+		return &Schema{}, nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", t)
+}
+
+// namedSchema returns the schema of a named type, a reference to its
+// component unless it is one of the types encoding/json treats specially.
+func (s *schemas) namedSchema(t *types.Named) (*Schema, error) {
+	obj := t.Obj()
+	switch qualifiedName(obj) {
+	case "time.Time":
+		return &Schema{Type: "string", Format: "date-time"}, nil
+	case "time.Duration":
+		return &Schema{Type: "integer", Format: "int64"}, nil
+	case "encoding/json.RawMessage":
+		return &Schema{}, nil
+	}
+	// Types encoding themselves are opaque, except as text.
+	switch {
+	case implements(t, "MarshalJSON"):
+		return &Schema{}, nil
+	case implements(t, "MarshalText"):
+		return &Schema{Type: "string"}, nil
+	}
+	if t.TypeArgs().Len() > 0 {
+		return nil, fmt.Errorf("unsupported generic type %s", t)
+	}
+	if err := s.component(obj); err != nil {
+		return nil, err
+	}
+	return &Schema{Ref: ref(obj.Name())}, nil
+}
+
+// component adds a named type to the components.
+func (s *schemas) component(obj *types.TypeName) error {
+	name := obj.Name()
+	if prev, ok := s.named[name]; ok {
+		if prev != obj {
+			return fmt.Errorf("types %s and %s have the same name", qualifiedName(prev), qualifiedName(obj))
+		}
+		return nil
+	}
+	if _, ok := s.components[name]; ok {
+		return fmt.Errorf("type %s has the name of a built-in schema", qualifiedName(obj))
+	}
+	// Reserve the name first, types may refer to themselves.
+	s.named[name] = obj
+	s.components[name] = &Schema{}
+	schema, err := s.schema(obj.Type().Underlying())
+	if err != nil {
+		return fmt.Errorf("type %s: %w", name, err)
+	}
+	schema.Description = s.docs[obj.Pos()]
+	s.components[name] = schema
+	return nil
+}
+
+// array returns the schema of a slice or array; bytes are base64 strings.
+func (s *schemas) array(elem types.Type) (*Schema, error) {
+	if b, ok := elem.(*types.Basic); ok && b.Kind() == types.Byte {
+		return &Schema{Type: "string", Format: "byte"}, nil
+	}
+	items, err := s.schema(elem)
+	if err != nil {
+		return nil, err
+	}
+	return &Schema{Type: "array", Items: items}, nil
+}
+
+// object returns the schema of a struct type.
+func (s *schemas) object(st *types.Struct) (*Schema, error) {
+	fields, err := s.fields(st)
+	if err != nil {
+		return nil, err
+	}
+	obj := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, f := range fields {
+		schema := f.schema
+		if f.doc != "" {
+			if schema.Ref != "" {
+				// Siblings of $ref are allowed in 3.1, keep the reference intact.
+				schema = &Schema{Ref: schema.Ref, Description: f.doc}
+			} else {
+				schema.Description = f.doc
+			}
+		}
+		obj.Properties[f.name] = schema
+		if f.required {
+			obj.Required = append(obj.Required, f.name)
+		}
+	}
+	sort.Strings(obj.Required)
+	return obj, nil
+}
+
+// qualifiedName returns the name of a type with its package path.
+func qualifiedName(obj *types.TypeName) string {
+	if obj.Pkg() == nil {
+		return obj.Name()
+	}
+	return obj.Pkg().Path() + "." + obj.Name()
+}
+
+// implements reports whether t or *t has a method of the given name, such
+// as MarshalJSON.
+func implements(t types.Type, name string) bool {
+	obj, _, _ := types.LookupFieldOrMethod(types.NewPointer(t), true, nil, name)
+	_, ok := obj.(*types.Func)
+	return ok
+}
+
+func basicSchema(t *types.Basic) (*Schema, bool) {
+	switch t.Kind() {
+	case types.String:
+		return &Schema{Type: "string"}, true
+	case types.Bool:
+		return &Schema{Type: "boolean"}, true
+	case types.Int, types.Int64, types.Uint, types.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}, true
+	case types.Int8, types.Int16, types.Int32, types.Uint8, types.Uint16, types.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}, true
+	case types.Float32:
+		return &Schema{Type: "number", Format: "float"}, true
+	case types.Float64:
+		return &Schema{Type: "number", Format: "double"}, true
+	}
+	return nil, false
+}
@@ -0,0 +1,81 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+)
+
+// ImageName returns the tag used for images built from a service Dockerfile.
+func ImageName(serviceName string) string {
+	return fmt.Sprintf("mm/%s:dev", serviceName)
+}
+
+// ContainerName returns the name of the container started for a service.
+func ContainerName(serviceName string) string {
+	return "mm-" + serviceName
+}
+
+// BuildImage builds the service image from its Dockerfile with the repo root
+// as context, which is what the generated Dockerfiles expect.
+func BuildImage(ctx context.Context, repoRoot, servicePath, serviceName string, opts RunOptions) error {
+	dockerfile := filepath.Join(servicePath, "Dockerfile")
+	if _, err := os.Stat(dockerfile); err != nil {
+		return fmt.Errorf("service %s has no Dockerfile: %w", serviceName, err)
+	}
+
+	buildCmd := exec.CommandContext(ctx, "docker", "build", "-f", dockerfile, "-t", ImageName(serviceName), repoRoot)
+	buildCmd.Dir = repoRoot
+	buildCmd.Stdout = opts.stdout()
+	buildCmd.Stderr = opts.stderr()
+	if err := buildCmd.Run(); err != nil {
+		return fmt.Errorf("docker build failed: %w", err)
+	}
+	return nil
+}
+
+// startDocker builds the service image and runs it in the background,
+// publishing port unless it is empty. Logs are streamed to the run options
+// output; stopping removes the container.
+func startDocker(ctx context.Context, repoRoot, servicePath, serviceName string, vars []EnvVar, port string, opts RunOptions) (*Instance, error) {
+	if err := BuildImage(ctx, repoRoot, servicePath, serviceName, opts); err != nil {
+		return nil, err
+	}
+
+	container := ContainerName(serviceName)
+	// Remove a leftover container from a previous run that was not cleaned up.
+	_ = exec.Command("docker", "rm", "-f", container).Run()
+
+	args := []string{"run", "--rm", "--name", container}
+	if port != "" {
+		args = append(args, "-p", port+":"+port)
+		if _, ok := lookupEnv(vars, "PORT"); !ok {
+			args = append(args, "-e", "PORT="+port)
+		}
+	}
+	for _, v := range vars {
+		args = append(args, "-e", v.String())
+	}
+	args = append(args, ImageName(serviceName))
+
+	// Not bound to ctx: killing the docker client would leave the container running.
+	runCmd := exec.Command("docker", args...)
+	runCmd.Dir = repoRoot
+	runCmd.Stdout = opts.stdout()
+	runCmd.Stderr = opts.stderr()
+	if err := runCmd.Start(); err != nil {
+		return nil, fmt.Errorf("docker run failed: %w", err)
+	}
+
+	inst := newInstance(serviceName, port)
+	go func() { inst.finish(runCmd.Wait()) }()
+	inst.stop = func() error {
+		if out, err := exec.Command("docker", "rm", "-f", container).CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to remove container %s: %w\n%s", container, err, string(out))
+		}
+		return nil
+	}
+	return inst, nil
+}
@@ -0,0 +1,102 @@
+package runtime
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stubDocker puts a docker script on PATH that appends its arguments to a
+// log. "run" blocks until "rm -f" of the same container kills it, as the
+// real client does. It returns the log path.
+func stubDocker(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	log := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+echo "$*" >> "` + log + `"
+case "$1" in
+run)
+	echo $$ > "` + dir + `/run.pid"
+	exec sleep 30
+	;;
+rm)
+	if [ -f "` + dir + `/run.pid" ]; then
+		kill "$(cat "` + dir + `/run.pid")"
+		rm "` + dir + `/run.pid"
+	fi
+	;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "docker"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	return log
+}
+
+func TestStartDockerService(t *testing.T) {
+	log := stubDocker(t)
+	t.Setenv("MM_PACKS_DIR", t.TempDir())
+	root := t.TempDir()
+	svc := filepath.Join(root, "services", "orders")
+	for name, content := range map[string]string{
+		".mm/manifest.toml":            "",
+		"services/orders/Dockerfile":   "FROM scratch\n",
+		"services/orders/service.toml": "[general]\nlang = \"go\"\ntype = \"http\"\n\n[environment]\nPORT = { docker = \"8123\" }\nGREETING = { docker = \"hi\", local = \"hello\" }\n",
+	} {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inst, err := StartService(context.Background(), svc, ModeDocker, RunOptions{Stdout: io.Discard, Stderr: io.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inst.Port != "8123" || inst.Health != "/" {
+		t.Errorf("instance port %q, health %q", inst.Port, inst.Health)
+	}
+	// Stop once the container runs, as mm up would on Ctrl-C.
+	pid := filepath.Join(filepath.Dir(log), "run.pid")
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := os.Stat(pid); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("docker run was not started")
+		}
+	}
+	if err := inst.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-inst.Done():
+	default:
+		t.Fatal("Stop returned before docker run exited")
+	}
+
+	data, err := os.ReadFile(log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Split(strings.TrimSpace(string(data)), "\n")
+	want := []string{
+		"build -f " + filepath.Join(svc, "Dockerfile") + " -t mm/orders:dev " + root,
+		"rm -f mm-orders",
+		"run --rm --name mm-orders -p 8123:8123 -e GREETING=hi -e PORT=8123 mm/orders:dev",
+		"rm -f mm-orders",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("docker calls:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
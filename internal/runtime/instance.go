@@ -0,0 +1,163 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// stopTimeout bounds how long a service may take to exit after an interrupt.
+const stopTimeout = 10 * time.Second
+
+// Instance is a service started by StartService.
+type Instance struct {
+	Name string
+	// Port is empty for services that do not listen, such as workers.
+	Port string
+	// Health is the HTTP path probed by WaitReady, if any.
+	Health string
+
+	done     chan struct{}
+	err      error
+	stop     func() error
+	stopOnce sync.Once
+	stopErr  error
+}
+
+func newInstance(name, port string) *Instance {
+	return &Instance{
+		Name: name,
+		Port: port,
+		done: make(chan struct{}),
+	}
+}
+
+func (i *Instance) finish(err error) {
+	i.err = err
+	close(i.done)
+}
+
+// Done is closed when the service exits.
+func (i *Instance) Done() <-chan struct{} {
+	return i.done
+}
+
+// Err returns the exit error once Done is closed.
+func (i *Instance) Err() error {
+	<-i.done
+	if i.err != nil {
+		return fmt.Errorf("%s exited: %w", i.Name, i.err)
+	}
+	return nil
+}
+
+// Stop shuts the service down and waits for it to exit. It is safe to call more than once.
+func (i *Instance) Stop() error {
+	i.stopOnce.Do(func() {
+		if i.stop != nil {
+			i.stopErr = i.stop()
+		}
+		<-i.done
+	})
+	return i.stopErr
+}
+
+// WaitReady blocks until the service is ready, it exits, or the timeout
+// elapses. Services without a port are ready once started. Others are ready
+// once their health path answers without a server error or, without one,
+// once a connection to their port stays open: proxies in front of the
+// service, such as docker's published ports or kubectl port-forward, accept
+// connections before the service listens but close them right away.
+func WaitReady(ctx context.Context, inst *Instance, timeout time.Duration) error {
+	if inst.Port == "" {
+		return nil
+	}
+	deadline := time.Now().Add(timeout)
+	addr := net.JoinHostPort("localhost", inst.Port)
+	for {
+		err := probe(addr, inst.Health)
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%s not ready on %s after %s: %w", inst.Name, addr, timeout, err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-inst.Done():
+			if err := inst.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("%s exited before becoming ready", inst.Name)
+		case <-time.After(250 * time.Millisecond):
+		}
+	}
+}
+
+// probeTimeout bounds a single readiness probe.
+const probeTimeout = time.Second
+
+// probeHold is how long a probe connection must stay open to count as
+// accepted by the service rather than by a proxy.
+const probeHold = 200 * time.Millisecond
+
+// probe checks once whether the service at addr is ready.
+func probe(addr, health string) error {
+	if health != "" {
+		client := &http.Client{Timeout: probeTimeout}
+		resp, err := client.Get("http://" + addr + health)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("GET %s answered %s", health, resp.Status)
+		}
+		return nil
+	}
+	conn, err := net.DialTimeout("tcp", addr, probeTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	if err := conn.SetReadDeadline(time.Now().Add(probeHold)); err != nil {
+		return err
+	}
+	if _, err := conn.Read(make([]byte, 1)); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return fmt.Errorf("connection closed: %w", err)
+	}
+	return nil
+}
+
+// portInUse reports whether something accepts connections on a local port.
+func portInUse(port string) bool {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort("localhost", port), probeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// interruptProcess asks a process to exit and kills it if it does not stop in time.
+func interruptProcess(p *os.Process, done <-chan struct{}) error {
+	if err := p.Signal(os.Interrupt); err != nil {
+		if errors.Is(err, os.ErrProcessDone) {
+			<-done
+			return nil
+		}
+		return p.Kill()
+	}
+	select {
+	case <-done:
+		return nil
+	case <-time.After(stopTimeout):
+		return p.Kill()
+	}
+}
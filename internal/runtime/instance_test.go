@@ -0,0 +1,92 @@
+package runtime
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// listen starts a TCP listener that hands each connection to handle.
+func listen(t *testing.T, handle func(net.Conn)) string {
+	t.Helper()
+	l, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go handle(conn)
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestProbeRejectsClosedConnections(t *testing.T) {
+	// A proxy with nothing behind it accepts, then closes.
+	addr := listen(t, func(c net.Conn) { c.Close() })
+	if err := probe(addr, ""); err == nil {
+		t.Fatal("probe accepted a connection closed by the peer")
+	}
+}
+
+func TestProbeAcceptsOpenConnections(t *testing.T) {
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+	addr := listen(t, func(c net.Conn) {
+		<-done
+		c.Close()
+	})
+	if err := probe(addr, ""); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestProbeHealth(t *testing.T) {
+	var status atomic.Int32
+	status.Store(http.StatusOK)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/healthz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(int(status.Load()))
+	}))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	if err := probe(addr, "/healthz"); err != nil {
+		t.Fatal(err)
+	}
+	status.Store(http.StatusBadGateway)
+	if err := probe(addr, "/healthz"); err == nil {
+		t.Fatal("probe accepted a 502")
+	}
+}
+
+func TestCheckPorts(t *testing.T) {
+	services := []service{
+		{name: "web", port: "8080"},
+		{name: "jobs"},
+		{name: "api", port: "8081"},
+		{name: "admin", port: "8080"},
+		{name: "worker"},
+	}
+	err := checkPorts(services, ModeLocal)
+	if err == nil {
+		t.Fatal("duplicate port accepted")
+	}
+	if got := err.Error(); !strings.Contains(got, "web, admin all use port 8080") || strings.Contains(got, "jobs") {
+		t.Errorf("error = %q", got)
+	}
+	if err := checkPorts(services[:3], ModeLocal); err != nil {
+		t.Errorf("distinct ports rejected: %v", err)
+	}
+}
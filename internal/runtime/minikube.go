@@ -0,0 +1,253 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"micromanager/internal/config"
+)
+
+// Manifest is a rendered Kubernetes manifest file.
+type Manifest struct {
+	Name    string
+	Content []byte
+}
+
+// manifestData is passed to the Kubernetes manifest templates.
+type manifestData struct {
+	Name  string
+	Image string
+	// Port is empty for services that do not listen, which get no Service.
+	Port         string
+	Env          []EnvVar
+	Dependencies []string
+}
+
+var manifestTemplates = []struct {
+	name string
+	text string
+}{
+	{name: "configmap.yaml", text: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: {{.Name}}-env
+  labels:
+    app: {{.Name}}
+    app.kubernetes.io/managed-by: mm
+data:
+{{- range .Env}}
+  {{.Name}}: {{quote .Value}}
+{{- else}} {}
+{{- end}}
+`},
+	{name: "deployment.yaml", text: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: {{.Name}}
+  labels:
+    app: {{.Name}}
+    app.kubernetes.io/managed-by: mm
+{{- if .Dependencies}}
+  annotations:
+    mm/dependencies: {{quote (join .Dependencies ",")}}
+{{- end}}
+spec:
+  replicas: 1
+  selector:
+    matchLabels:
+      app: {{.Name}}
+  template:
+    metadata:
+      labels:
+        app: {{.Name}}
+    spec:
+      containers:
+        - name: {{.Name}}
+          image: {{.Image}}
+          imagePullPolicy: Never
+{{- if .Port}}
+          ports:
+            - containerPort: {{.Port}}
+{{- end}}
+          envFrom:
+            - configMapRef:
+                name: {{.Name}}-env
+`},
+	{name: "service.yaml", text: `{{if .Port}}apiVersion: v1
+kind: Service
+metadata:
+  name: {{.Name}}
+  labels:
+    app: {{.Name}}
+    app.kubernetes.io/managed-by: mm
+spec:
+  selector:
+    app: {{.Name}}
+  ports:
+    - port: {{.Port}}
+      targetPort: {{.Port}}
+{{end}}`},
+}
+
+// ManifestDir returns the directory where Kubernetes manifests of a service are written.
+func ManifestDir(repoRoot, serviceName string) string {
+	return filepath.Join(repoRoot, "build", serviceName, "k8s")
+}
+
+// RenderManifests produces a ConfigMap, Deployment and Service for a service
+// using the minikube column of its environment. Services whose type does not
+// listen get no Service. Every declared dependency is exposed to the
+// container as <DEPENDENCY>_ADDR pointing at its cluster Service.
+func RenderManifests(repoRoot, serviceName string, cfg config.ServiceConfig) ([]Manifest, error) {
+	vars := serviceEnv(cfg.Environment, ModeMinikube)
+	st, err := serviceType(repoRoot, cfg)
+	if err != nil {
+		return nil, err
+	}
+	port := ""
+	if st.Listens() {
+		port = servicePort(vars, ModeMinikube)
+		if _, ok := lookupEnv(vars, "PORT"); !ok {
+			vars = append(vars, EnvVar{Name: "PORT", Value: port})
+		}
+		if _, err := strconv.Atoi(port); err != nil {
+			return nil, fmt.Errorf("invalid PORT %q for %s", port, serviceName)
+		}
+	}
+
+	for _, dep := range cfg.Dependencies.Services {
+		depPort := strconv.Itoa(defaultPortFor(ModeMinikube))
+		if depCfg, err := config.LoadServiceConfig(repoRoot, dep); err == nil {
+			depPort = servicePort(serviceEnv(depCfg.Environment, ModeMinikube), ModeMinikube)
+		}
+		name := strings.ToUpper(strings.ReplaceAll(dep, "-", "_")) + "_ADDR"
+		if _, ok := lookupEnv(vars, name); !ok {
+			vars = append(vars, EnvVar{Name: name, Value: dep + ":" + depPort})
+		}
+	}
+
+	data := manifestData{
+		Name:         serviceName,
+		Image:        ImageName(serviceName),
+		Port:         port,
+		Env:          vars,
+		Dependencies: cfg.Dependencies.Services,
+	}
+	funcs := template.FuncMap{
+		"quote": strconv.Quote,
+		"join":  strings.Join,
+	}
+
+	var manifests []Manifest
+	for _, mt := range manifestTemplates {
+		tpl, err := template.New(mt.name).Funcs(funcs).Parse(mt.text)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := tpl.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		if buf.Len() == 0 {
+			continue
+		}
+		manifests = append(manifests, Manifest{Name: mt.name, Content: buf.Bytes()})
+	}
+	return manifests, nil
+}
+
+// WriteManifests renders the manifests into build/<service>/k8s and returns the directory.
+func WriteManifests(repoRoot, serviceName string, cfg config.ServiceConfig) (string, error) {
+	manifests, err := RenderManifests(repoRoot, serviceName, cfg)
+	if err != nil {
+		return "", err
+	}
+	dir := ManifestDir(repoRoot, serviceName)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	// Drop manifests of an earlier render that no longer apply, such as
+	// the Service of a service that stopped listening.
+	for _, mt := range manifestTemplates {
+		if err := os.Remove(filepath.Join(dir, mt.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+	for _, m := range manifests {
+		if err := os.WriteFile(filepath.Join(dir, m.Name), m.Content, 0o644); err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+// startMinikube builds the image inside minikube, applies the manifests and
+// port-forwards the service, or follows its logs when port is empty.
+// Stopping deletes the applied resources.
+func startMinikube(ctx context.Context, repoRoot, serviceName string, cfg config.ServiceConfig, port string, opts RunOptions) (*Instance, error) {
+	dir, err := WriteManifests(repoRoot, serviceName, cfg)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RenderOnly {
+		fmt.Printf("Manifests written to %s\n", dir)
+		return nil, nil
+	}
+
+	dockerfile := filepath.ToSlash(filepath.Join("services", serviceName, "Dockerfile"))
+	steps := [][]string{
+		{"minikube", "image", "build", "-t", ImageName(serviceName), "-f", dockerfile, "."},
+		{"kubectl", "apply", "-f", dir},
+		{"kubectl", "rollout", "restart", "deployment/" + serviceName},
+		{"kubectl", "rollout", "status", "deployment/" + serviceName},
+	}
+	for _, step := range steps {
+		if err := runStreamed(ctx, repoRoot, step, opts); err != nil {
+			return nil, err
+		}
+	}
+
+	forward := exec.Command("kubectl", "port-forward", "service/"+serviceName, port+":"+port)
+	if port == "" {
+		forward = exec.Command("kubectl", "logs", "-f", "deployment/"+serviceName)
+	}
+	forward.Dir = repoRoot
+	forward.Stdout = opts.stdout()
+	forward.Stderr = opts.stderr()
+	if err := forward.Start(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w", strings.Join(forward.Args[1:3], " "), err)
+	}
+
+	inst := newInstance(serviceName, port)
+	go func() { inst.finish(forward.Wait()) }()
+	inst.stop = func() error {
+		stopErr := interruptProcess(forward.Process, inst.Done())
+		del := exec.Command("kubectl", "delete", "--ignore-not-found", "-f", dir)
+		del.Dir = repoRoot
+		if out, err := del.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to delete %s resources: %w\n%s", serviceName, err, string(out))
+		}
+		return stopErr
+	}
+	return inst, nil
+}
+
+func runStreamed(ctx context.Context, dir string, args []string, opts RunOptions) error {
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	cmd.Stdout = opts.stdout()
+	cmd.Stderr = opts.stderr()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s failed: %w", strings.Join(args[:2], " "), err)
+	}
+	return nil
+}
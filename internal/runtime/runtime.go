@@ -3,11 +3,15 @@ package runtime
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strconv"
 
-	"github.com/pelletier/go-toml/v2"
+	"micromanager/internal/config"
+	"micromanager/internal/lang"
 )
 
 const (
@@ -34,13 +38,67 @@ func Run(ctx context.Context, root, target, mode string) (string, error) {
 	return endpoint, nil
 }
 
-// RunService builds and executes a service with environment variables from service.toml.
-func RunService(ctx context.Context, servicePath, mode string) error {
+// RunOptions customizes how a service is run.
+type RunOptions struct {
+	// RenderOnly writes the Kubernetes manifests in minikube mode without
+	// building or deploying anything.
+	RenderOnly bool
+	// Stdout and Stderr receive the service output. They default to the
+	// process streams.
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func (o RunOptions) stdout() io.Writer {
+	if o.Stdout != nil {
+		return o.Stdout
+	}
+	return os.Stdout
+}
+
+func (o RunOptions) stderr() io.Writer {
+	if o.Stderr != nil {
+		return o.Stderr
+	}
+	return os.Stderr
+}
+
+// RunService builds and executes a service with environment variables from
+// service.toml and stops it when the context is cancelled.
+func RunService(ctx context.Context, servicePath, mode string, opts RunOptions) error {
+	inst, err := StartService(ctx, servicePath, mode, opts)
+	if err != nil || inst == nil {
+		return err
+	}
+
+	select {
+	case <-inst.Done():
+		return inst.Err()
+	case <-ctx.Done():
+		return inst.Stop()
+	}
+}
+
+// service is a service resolved for a mode, before it is started.
+type service struct {
+	path     string
+	name     string
+	repoRoot string
+	cfg      config.ServiceConfig
+	typ      lang.ServiceType
+	vars     []EnvVar
+	// port is empty when the service type does not listen.
+	port string
+}
+
+// resolveService loads the configuration of the service in servicePath and
+// resolves its environment and port for mode.
+func resolveService(servicePath, mode string) (service, error) {
 	// Normalize path
 	if !filepath.IsAbs(servicePath) {
 		cwd, err := os.Getwd()
 		if err != nil {
-			return err
+			return service{}, err
 		}
 		servicePath = filepath.Join(cwd, servicePath)
 	}
@@ -48,77 +106,197 @@ func RunService(ctx context.Context, servicePath, mode string) error {
 	// Check if service directory exists
 	info, err := os.Stat(servicePath)
 	if err != nil {
-		return fmt.Errorf("service path error: %w", err)
+		return service{}, fmt.Errorf("service path error: %w", err)
 	}
 	if !info.IsDir() {
-		return fmt.Errorf("path is not a directory: %s", servicePath)
+		return service{}, fmt.Errorf("path is not a directory: %s", servicePath)
 	}
 
 	// Load service configuration
 	configPath := filepath.Join(servicePath, "service.toml")
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return fmt.Errorf("failed to read service.toml: %w", err)
+		return service{}, fmt.Errorf("failed to read service.toml: %w", err)
 	}
 
-	var cfg struct {
-		Environment map[string]map[string]interface{} `toml:"environment"`
+	cfg, err := config.ParseServiceConfig(data)
+	if err != nil {
+		return service{}, fmt.Errorf("failed to parse service.toml: %w", err)
 	}
-	if err := toml.Unmarshal(data, &cfg); err != nil {
-		return fmt.Errorf("failed to parse service.toml: %w", err)
+
+	repoRoot, err := FindRepoRoot(servicePath)
+	if err != nil {
+		return service{}, err
 	}
 
-	// Find repo root by looking for .mm directory
-	repoRoot := servicePath
-	for {
-		if _, err := os.Stat(filepath.Join(repoRoot, ".mm")); err == nil {
-			break
-		}
-		parent := filepath.Dir(repoRoot)
-		if parent == repoRoot {
-			return fmt.Errorf("could not find repo root (.mm directory)")
-		}
-		repoRoot = parent
+	svc := service{
+		path:     servicePath,
+		name:     filepath.Base(servicePath),
+		repoRoot: repoRoot,
+		cfg:      cfg,
+		vars:     serviceEnv(cfg.Environment, mode),
+	}
+	if svc.typ, err = serviceType(repoRoot, cfg); err != nil {
+		return service{}, err
+	}
+	if svc.typ.Listens() {
+		svc.port = servicePort(svc.vars, mode)
+	}
+	return svc, nil
+}
+
+// StartService builds a service and starts it in the background. It returns a
+// nil instance when nothing was started, e.g. with RenderOnly.
+func StartService(ctx context.Context, servicePath, mode string, opts RunOptions) (*Instance, error) {
+	svc, err := resolveService(servicePath, mode)
+	if err != nil {
+		return nil, err
+	}
+	inst, err := startService(ctx, svc, mode, opts)
+	if inst != nil {
+		inst.Health = svc.typ.Health
+	}
+	return inst, err
+}
+
+func startService(ctx context.Context, svc service, mode string, opts RunOptions) (*Instance, error) {
+	servicePath, serviceName, repoRoot := svc.path, svc.name, svc.repoRoot
+	cfg, st, vars, port := svc.cfg, svc.typ, svc.vars, svc.port
+
+	switch {
+	case mode == ModeDocker, cfg.General.External && mode == ModeLocal:
+		// External services only ship a Dockerfile, so they always run in a container.
+		return startDocker(ctx, repoRoot, servicePath, serviceName, vars, port, opts)
+	case mode == ModeMinikube:
+		return startMinikube(ctx, repoRoot, serviceName, cfg, port, opts)
 	}
 
 	// Build service binary in <repo-root>/build/<service-name>
-	serviceName := filepath.Base(servicePath)
 	buildDir := filepath.Join(repoRoot, "build", serviceName)
 	if err := os.MkdirAll(buildDir, 0o755); err != nil {
-		return fmt.Errorf("failed to create build directory: %w", err)
+		return nil, fmt.Errorf("failed to create build directory: %w", err)
 	}
 	binaryPath := filepath.Join(buildDir, serviceName)
 
-	// Try building from ./server if it exists, otherwise use ./
-	buildTarget := "./server"
-	serverPath := filepath.Join(servicePath, "server")
-	if _, err := os.Stat(serverPath); err != nil {
-		buildTarget = "./"
+	// Build the service type's target; without one, try ./server if it
+	// exists, otherwise use ./
+	buildTarget := st.Build
+	if buildTarget == "" {
+		buildTarget = "./server"
+		serverPath := filepath.Join(servicePath, "server")
+		if _, err := os.Stat(serverPath); err != nil {
+			buildTarget = "./"
+		}
 	}
 
 	buildCmd := exec.CommandContext(ctx, "go", "build", "-o", binaryPath, buildTarget)
 	buildCmd.Dir = servicePath
 	if output, err := buildCmd.CombinedOutput(); err != nil {
-		return fmt.Errorf("build failed: %w\n%s", err, string(output))
+		return nil, fmt.Errorf("build failed: %w\n%s", err, string(output))
 	}
 
 	// Prepare environment variables from service.toml
 	env := os.Environ()
-	for varName, modeValues := range cfg.Environment {
-		if modeValue, ok := modeValues[mode]; ok {
-			env = append(env, fmt.Sprintf("%s=%v", varName, modeValue))
-		}
+	for _, v := range vars {
+		env = append(env, v.String())
 	}
 
 	// Run the service
-	runCmd := exec.CommandContext(ctx, binaryPath)
+	runCmd := exec.Command(binaryPath)
 	runCmd.Dir = servicePath
 	runCmd.Env = env
-	runCmd.Stdout = os.Stdout
-	runCmd.Stderr = os.Stderr
-	runCmd.Stdin = os.Stdin
+	runCmd.Stdout = opts.stdout()
+	runCmd.Stderr = opts.stderr()
+	if opts.Stdout == nil {
+		runCmd.Stdin = os.Stdin
+	}
+	if err := runCmd.Start(); err != nil {
+		return nil, err
+	}
+
+	inst := newInstance(serviceName, port)
+	go func() { inst.finish(runCmd.Wait()) }()
+	inst.stop = func() error {
+		return interruptProcess(runCmd.Process, inst.Done())
+	}
+	return inst, nil
+}
 
-	return runCmd.Run()
+// serviceType returns the pack's service type of a service. External services
+// and services without a pack get a zero ServiceType, which listens on PORT.
+func serviceType(repoRoot string, cfg config.ServiceConfig) (lang.ServiceType, error) {
+	if cfg.General.External {
+		return lang.ServiceType{}, nil
+	}
+	langName := cfg.General.Lang
+	if langName == "" {
+		defaults, err := config.LoadDefaults(repoRoot)
+		if err != nil {
+			return lang.ServiceType{}, err
+		}
+		langName = defaults.Lang
+	}
+	p, err := lang.FindByLang(repoRoot, langName)
+	if err != nil || p == nil {
+		return lang.ServiceType{}, err
+	}
+	return lang.FindServiceType(*p, cfg.General.Type)
+}
+
+// FindRepoRoot walks up from path to the directory containing .mm.
+func FindRepoRoot(path string) (string, error) {
+	repoRoot := path
+	for {
+		if _, err := os.Stat(filepath.Join(repoRoot, ".mm")); err == nil {
+			return repoRoot, nil
+		}
+		parent := filepath.Dir(repoRoot)
+		if parent == repoRoot {
+			return "", fmt.Errorf("could not find repo root (.mm directory)")
+		}
+		repoRoot = parent
+	}
+}
+
+// EnvVar is a single environment variable resolved for a mode.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+func (v EnvVar) String() string {
+	return v.Name + "=" + v.Value
+}
+
+// serviceEnv picks the values for mode from the [environment] table, sorted by name.
+func serviceEnv(environment map[string]map[string]string, mode string) []EnvVar {
+	var vars []EnvVar
+	for varName, modeValues := range environment {
+		if modeValue, ok := modeValues[mode]; ok {
+			vars = append(vars, EnvVar{Name: varName, Value: modeValue})
+		}
+	}
+	sort.Slice(vars, func(i, j int) bool {
+		return vars[i].Name < vars[j].Name
+	})
+	return vars
+}
+
+func lookupEnv(vars []EnvVar, name string) (string, bool) {
+	for _, v := range vars {
+		if v.Name == name {
+			return v.Value, true
+		}
+	}
+	return "", false
+}
+
+// servicePort returns the PORT declared for the mode or the mode default.
+func servicePort(vars []EnvVar, mode string) string {
+	if port, ok := lookupEnv(vars, "PORT"); ok && port != "" {
+		return port
+	}
+	return strconv.Itoa(defaultPortFor(mode))
 }
 
 func defaultPortFor(mode string) int {
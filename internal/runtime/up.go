@@ -0,0 +1,168 @@
+package runtime
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"micromanager/internal/graph"
+)
+
+// DefaultReadyTimeout bounds how long mm up waits for a service to accept connections.
+const DefaultReadyTimeout = 60 * time.Second
+
+// UpOptions configures starting several services together.
+type UpOptions struct {
+	Mode         string
+	ReadyTimeout time.Duration
+}
+
+// Up starts the named services and their dependencies in dependency order,
+// waiting for each to become ready before starting its dependents. Services
+// run until the context is cancelled or one of them exits, and are then
+// stopped in reverse order. With no names, every service is started.
+func Up(ctx context.Context, root string, names []string, opts UpOptions) error {
+	g, err := graph.Load(root)
+	if err != nil {
+		return err
+	}
+	order, err := g.Order(names)
+	if err != nil {
+		return err
+	}
+	if len(order) == 0 {
+		return fmt.Errorf("no services found under %s", filepath.Join(root, "services"))
+	}
+
+	timeout := opts.ReadyTimeout
+	if timeout <= 0 {
+		timeout = DefaultReadyTimeout
+	}
+
+	services := make([]service, 0, len(order))
+	for _, name := range order {
+		svc, err := resolveService(filepath.Join(root, "services", name), opts.Mode)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		services = append(services, svc)
+	}
+	if err := checkPorts(services, opts.Mode); err != nil {
+		return err
+	}
+
+	var mu sync.Mutex
+	var started []*Instance
+	defer func() {
+		for i := len(started) - 1; i >= 0; i-- {
+			fmt.Printf("Stopping %s\n", started[i].Name)
+			if err := started[i].Stop(); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}()
+
+	for _, svc := range services {
+		name := svc.name
+		// Another process on the port would pass for the service.
+		if svc.port != "" && portInUse(svc.port) {
+			return fmt.Errorf("port %s of %s is already in use; stop what holds it or set PORT for %s in its [environment]", svc.port, name, opts.Mode)
+		}
+		fmt.Printf("Starting %s\n", name)
+		inst, err := startService(ctx, svc, opts.Mode, RunOptions{
+			Stdout: &prefixWriter{prefix: name, out: os.Stdout, mu: &mu},
+			Stderr: &prefixWriter{prefix: name, out: os.Stderr, mu: &mu},
+		})
+		if err != nil {
+			return fmt.Errorf("start %s: %w", name, err)
+		}
+		inst.Health = svc.typ.Health
+		started = append(started, inst)
+		if err := WaitReady(ctx, inst, timeout); err != nil {
+			if errors.Is(err, context.Canceled) {
+				return nil
+			}
+			return err
+		}
+		if inst.Port == "" {
+			fmt.Printf("%s started\n", name)
+		} else {
+			fmt.Printf("%s ready on port %s\n", name, inst.Port)
+		}
+	}
+
+	exited := make(chan *Instance, len(started))
+	for _, inst := range started {
+		go func(inst *Instance) {
+			<-inst.Done()
+			exited <- inst
+		}(inst)
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil
+	case inst := <-exited:
+		if err := inst.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("%s exited", inst.Name)
+	}
+}
+
+// checkPorts rejects services sharing a port, since they cannot run side by
+// side and one would pass for the other when waiting for readiness.
+func checkPorts(services []service, mode string) error {
+	owners := make(map[string][]string)
+	var ports []string
+	for _, svc := range services {
+		if svc.port == "" {
+			continue
+		}
+		if len(owners[svc.port]) == 0 {
+			ports = append(ports, svc.port)
+		}
+		owners[svc.port] = append(owners[svc.port], svc.name)
+	}
+	var errs []error
+	for _, port := range ports {
+		if names := owners[port]; len(names) > 1 {
+			errs = append(errs, fmt.Errorf("%s all use port %s; set PORT for %s in their [environment]", strings.Join(names, ", "), port, mode))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// prefixWriter prefixes every line with the service name so that the output
+// of several services can share a terminal.
+type prefixWriter struct {
+	prefix string
+	out    io.Writer
+	mu     *sync.Mutex
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.mu.Lock()
+		_, err := fmt.Fprintf(w.out, "[%s] %s", w.prefix, w.buf[:i+1])
+		w.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
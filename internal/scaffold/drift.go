@@ -0,0 +1,152 @@
+package scaffold
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"micromanager/internal/config"
+	"micromanager/internal/lang"
+)
+
+// DriftKind classifies how a generated file diverged from the manifest.
+type DriftKind string
+
+const (
+	// DriftModified marks files that were edited by hand after generation.
+	DriftModified DriftKind = "modified"
+	// DriftDeleted marks generated files that no longer exist.
+	DriftDeleted DriftKind = "deleted"
+	// DriftStale marks files whose pack now renders different content.
+	DriftStale DriftKind = "stale"
+	// DriftNew marks files the pack would now generate but were never written.
+	DriftNew DriftKind = "new"
+)
+
+// Drift describes a single divergence between the tree, the manifest and the pack.
+type Drift struct {
+	Path    string
+	Service string
+	Kind    DriftKind
+	Note    string
+}
+
+// CheckDrift compares every file recorded in the manifest with the working
+// tree and with what the service's pack renders today.
+func CheckDrift(root string, opts UpdateOptions) ([]Drift, error) {
+	manifest, err := lang.LoadManifest(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var drifts []Drift
+	for _, e := range manifest.Files {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(e.Path)))
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			drifts = append(drifts, Drift{Path: e.Path, Service: e.Service, Kind: DriftDeleted})
+		case err != nil:
+			return nil, err
+		case lang.HashContent(data) != e.Hash:
+			drifts = append(drifts, Drift{Path: e.Path, Service: e.Service, Kind: DriftModified})
+		}
+	}
+
+	// Re-render each service with the data it was generated with.
+	rendered := make(map[string]bool)
+	checked := make(map[string]bool)
+	for _, service := range manifestServices(manifest) {
+		cfg, err := config.LoadServiceConfig(root, service.ServiceName)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("load %s config: %w", service.ServiceName, err)
+		}
+		langName := cfg.General.Lang
+		if langName == "" {
+			langName = opts.Defaults.Lang
+		}
+		p, err := lang.FindByLang(root, langName)
+		if err != nil {
+			return nil, err
+		}
+		if p == nil {
+			return nil, fmt.Errorf("no pack found for %s (lang=%s)", service.ServiceName, langName)
+		}
+		// The API is read from the service, it is not part of the recorded data.
+		current, err := lang.LoadTemplateData(root, service.ServiceName, cfg)
+		if err != nil {
+			return nil, err
+		}
+		service.API = current.API
+		files, err := lang.Render(*p, service)
+		if err != nil {
+			return nil, fmt.Errorf("render %s: %w", service.ServiceName, err)
+		}
+		checked[service.ServiceName] = true
+
+		for _, f := range files {
+			if f.Path == lang.ServiceConfigPath(service.ServiceName) || rendered[f.Path] {
+				continue
+			}
+			rendered[f.Path] = true
+			e, ok := manifest.Lookup(f.Path)
+			if !ok {
+				drifts = append(drifts, Drift{Path: f.Path, Service: service.ServiceName, Kind: DriftNew})
+				continue
+			}
+			// The manifest hash covers edits mm made after generating, such
+			// as mm add endpoint appending to api.toml; staleness is measured
+			// against the last generated content.
+			generated := e.Hash
+			if base, ok := lang.LoadGenerated(root, f.Path); ok {
+				generated = lang.HashContent(base)
+			}
+			if lang.HashContent(f.Content) != generated {
+				note := ""
+				if e.Pack != p.Meta.ID || e.PackVersion != p.Meta.Version {
+					note = fmt.Sprintf("%s@%s -> %s@%s", e.Pack, e.PackVersion, p.Meta.ID, p.Meta.Version)
+				}
+				drifts = append(drifts, Drift{Path: f.Path, Service: e.Service, Kind: DriftStale, Note: note})
+			}
+		}
+	}
+	for _, e := range manifest.Files {
+		// Shared files are rendered by every service.
+		shared := e.Service == "" && len(checked) > 0
+		if (shared || checked[e.Service]) && !rendered[e.Path] {
+			drifts = append(drifts, Drift{Path: e.Path, Service: e.Service, Kind: DriftStale, Note: "no longer generated by pack"})
+		}
+	}
+
+	sort.SliceStable(drifts, func(i, j int) bool {
+		return drifts[i].Path < drifts[j].Path
+	})
+	return drifts, nil
+}
+
+// manifestServices returns the template data of every service in the
+// manifest, taken from the service's own files.
+func manifestServices(m *lang.Manifest) []lang.TemplateData {
+	byName := make(map[string]lang.TemplateData)
+	var names []string
+	for _, e := range m.Files {
+		if e.Service == "" {
+			continue
+		}
+		if _, ok := byName[e.Service]; !ok {
+			names = append(names, e.Service)
+		}
+		byName[e.Service] = e.Data
+	}
+	sort.Strings(names)
+	services := make([]lang.TemplateData, 0, len(names))
+	for _, name := range names {
+		services = append(services, byName[name])
+	}
+	return services
+}
@@ -0,0 +1,745 @@
+package scaffold
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"micromanager/internal/config"
+	"micromanager/internal/diff"
+	"micromanager/internal/goedit"
+	"micromanager/internal/lang"
+	"micromanager/internal/mocks"
+)
+
+// AddEndpointOptions describes an endpoint to add to a service.
+type AddEndpointOptions struct {
+	// Method is an HTTP method such as POST.
+	Method string
+	// Path is relative to the route prefix of the service; ":name" and
+	// "{name}" segments become string fields of the request.
+	Path string
+	// Name is the operation, e.g. CreateOrder. The types are named
+	// <Name>Request and <Name>Response.
+	Name     string
+	Defaults config.Defaults
+}
+
+// AddEndpointReport lists what AddEndpoint changed.
+type AddEndpointReport struct {
+	// Files are the repo-relative Go files that were edited, followed by
+	// generated files that took the change as rendered, such as tests, and
+	// the regenerated mock of the service.
+	Files []string
+	// API is the API definition the operation was recorded in, empty when
+	// the service has none.
+	API string
+}
+
+// AddEndpoint adds an operation to the Go code of an existing service by
+// editing its syntax trees: request and response types in api/, a method of
+// api.Service, a route in NewRouter, an HTTPClient method and a core stub
+// returning errNotImplemented. Nothing is written when any of them already
+// exists.
+//
+// When the service has an API definition, the operation is recorded there as
+// well and the generated snapshots are rebased onto it, so the next update
+// does not take the endpoint for a local change. A mock created by mm mocks
+// is regenerated once the change is written.
+func AddEndpoint(root, name string, opts AddEndpointOptions) (AddEndpointReport, error) {
+	var report AddEndpointReport
+	cfg, err := config.LoadServiceConfig(root, name)
+	if err != nil {
+		return report, fmt.Errorf("load %s config: %w", name, err)
+	}
+	if cfg.General.External {
+		return report, fmt.Errorf("%s is an external service", name)
+	}
+	if t := cfg.General.Type; t != "" && t != "http" {
+		return report, fmt.Errorf("%s is a %s service, endpoints can only be added to http services", name, t)
+	}
+
+	ep, err := newEndpoint(opts)
+	if err != nil {
+		return report, err
+	}
+
+	dir := filepath.Join(root, "services", name)
+	vars := lang.NewTemplateData(root, name, cfg)
+	pkgs := make(map[string]*goedit.Package)
+	for _, pkg := range []string{"api", "server", "client", "core"} {
+		p, err := goedit.LoadPackage(filepath.Join(dir, pkg))
+		if err != nil {
+			return report, err
+		}
+		p.SetLocal(vars.ProjectName)
+		pkgs[pkg] = p
+	}
+	imports := endpointImports{
+		api: path.Join(vars.ProjectName, "services", name, "api"),
+		std: path.Join(vars.ProjectName, "common", "std"),
+	}
+
+	err = errors.Join(
+		addAPIEndpoint(pkgs["api"], ep),
+		addRoute(pkgs["server"], ep, imports),
+		addClientMethod(pkgs["client"], ep, imports),
+		addCoreStub(pkgs["core"], ep, imports),
+	)
+	if err != nil {
+		return report, fmt.Errorf("%s: %w", name, err)
+	}
+
+	t, err := lang.BeginTxn(root)
+	if err != nil {
+		return report, err
+	}
+	defer t.Close()
+
+	for _, pkg := range []string{"api", "server", "client", "core"} {
+		for _, f := range pkgs[pkg].Changed() {
+			content, err := f.Format()
+			if err != nil {
+				return report, err
+			}
+			rel, err := filepath.Rel(root, f.Path)
+			if err != nil {
+				return report, err
+			}
+			rel = filepath.ToSlash(rel)
+			if err := t.Write(rel, content); err != nil {
+				return report, err
+			}
+			report.Files = append(report.Files, rel)
+		}
+	}
+
+	api, regenerated, err := recordOperation(t, name, cfg, ep, opts.Defaults, report.Files)
+	if err != nil {
+		return report, err
+	}
+	report.API = api
+	report.Files = append(report.Files, regenerated...)
+
+	mocked := mocks.Exists(root, name)
+	if mocked {
+		t.ProtectFiles(path.Dir(mocks.Path(name)))
+	}
+	if err := t.Commit(); err != nil {
+		return report, err
+	}
+	if mocked {
+		refreshed, err := refreshMocks(root, []string{name})
+		if err != nil {
+			return report, t.Abort(err)
+		}
+		for _, f := range refreshed {
+			if f.Status != StatusUnchanged {
+				report.Files = append(report.Files, f.Path)
+			}
+		}
+	}
+	return report, nil
+}
+
+// endpoint is a validated operation with its request and response types.
+type endpoint struct {
+	op       config.Operation
+	types    []config.TypeDef
+	data     lang.OperationData
+	typeData []lang.TypeData
+}
+
+// endpointImports are the import paths of the service packages generated
+// code refers to.
+type endpointImports struct {
+	api string
+	std string
+}
+
+func newEndpoint(opts AddEndpointOptions) (endpoint, error) {
+	op := config.Operation{
+		Name:     opts.Name,
+		Method:   strings.ToUpper(opts.Method),
+		Path:     opts.Path,
+		Request:  opts.Name + "Request",
+		Response: opts.Name + "Response",
+	}
+	req := config.TypeDef{Name: op.Request}
+	for _, param := range op.PathParams() {
+		f := config.Field{Name: exportedName(param), Type: "string"}
+		if f.JSONName() != param {
+			f.JSON = param
+		}
+		req.Fields = append(req.Fields, f)
+	}
+	types := []config.TypeDef{req, {Name: op.Response}}
+	api := config.APIConfig{Operations: []config.Operation{op}, Types: types}
+	if err := api.Validate(); err != nil {
+		return endpoint{}, err
+	}
+	data := lang.NewAPIData(api)
+	return endpoint{op: op, types: types, data: data.Operations[0], typeData: data.Types}, nil
+}
+
+// addAPIEndpoint declares the types and adds the method to api.Service.
+func addAPIEndpoint(pkg *goedit.Package, ep endpoint) error {
+	f, spec := pkg.Type("Service")
+	if spec == nil {
+		return fmt.Errorf("%s: no Service interface", pkg.Dir)
+	}
+	iface, ok := spec.Type.(*ast.InterfaceType)
+	if !ok {
+		return fmt.Errorf("%s: Service is not an interface", pkg.Dir)
+	}
+	var errs []error
+	for _, m := range iface.Methods.List {
+		for _, n := range m.Names {
+			if n.Name == ep.op.Name {
+				errs = append(errs, fmt.Errorf("api.Service already has %s", ep.op.Name))
+			}
+		}
+	}
+	for _, t := range ep.typeData {
+		if pkg.Declares(t.Name) {
+			errs = append(errs, fmt.Errorf("api.%s already exists", t.Name))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+
+	method := ep.op.Name + strings.TrimPrefix(goedit.Print(signature(ep, "")), "func")
+	if f.StartsLine(iface.Methods.Closing) {
+		f.InsertLine(iface.Methods.Closing, "\t"+method+"\n")
+	} else {
+		f.Insert(iface.Methods.Closing, "\n\t"+method+"\n")
+	}
+	f.AddImport("context")
+
+	// Types go with the other API types when they have a file of their own.
+	types := pkg.File("types.go")
+	if types == nil {
+		types = f
+	}
+	for _, t := range ep.typeData {
+		fields := &ast.FieldList{}
+		for _, fd := range t.Fields {
+			fields.List = append(fields.List, &ast.Field{
+				Names: []*ast.Ident{ast.NewIdent(fd.Name)},
+				Type:  ast.NewIdent(fd.Type),
+				Tag:   &ast.BasicLit{Kind: token.STRING, Value: "`" + fd.Tag + "`"},
+			})
+		}
+		decl := &ast.GenDecl{Tok: token.TYPE, Specs: []ast.Spec{
+			&ast.TypeSpec{Name: ast.NewIdent(t.Name), Type: &ast.StructType{Fields: fields}},
+		}}
+		types.Append(goedit.Print(decl) + "\n")
+	}
+	return nil
+}
+
+// addRoute registers the operation in NewRouter, in the route group of the
+// service, before the router is returned.
+func addRoute(pkg *goedit.Package, ep endpoint, imports endpointImports) error {
+	f, fn := pkg.Func("NewRouter")
+	if fn == nil || fn.Body == nil {
+		return fmt.Errorf("%s: no NewRouter function", pkg.Dir)
+	}
+	var service string
+	for _, field := range fn.Type.Params.List {
+		if goedit.Print(field.Type) == "api.Service" && len(field.Names) == 1 {
+			service = field.Names[0].Name
+		}
+	}
+	var ret *ast.ReturnStmt
+	if n := len(fn.Body.List); n > 0 {
+		ret, _ = fn.Body.List[n-1].(*ast.ReturnStmt)
+	}
+	if service == "" || ret == nil || len(ret.Results) != 1 {
+		return fmt.Errorf("%s: NewRouter must take an api.Service and end by returning the router", pkg.Dir)
+	}
+
+	var group string
+	var exists bool
+	ast.Inspect(fn.Body, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		lit, ok := call.Args[0].(*ast.BasicLit)
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+		route, _ := strconv.Unquote(lit.Value)
+		if sel.Sel.Name == ep.data.Method && (config.Operation{Path: route}).RoutePath() == ep.data.Path {
+			exists = true
+		}
+		return true
+	})
+	if exists {
+		return fmt.Errorf("NewRouter already has a route %s %s", ep.data.Method, ep.data.Path)
+	}
+	for _, stmt := range fn.Body.List {
+		assign, ok := stmt.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.DEFINE || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+			continue
+		}
+		call, ok := assign.Rhs[0].(*ast.CallExpr)
+		if !ok {
+			continue
+		}
+		if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Group" {
+			group = assign.Lhs[0].(*ast.Ident).Name
+			break
+		}
+	}
+
+	route := func(group string) string {
+		return fmt.Sprintf("%s.%s(%s, func(c *gin.Context) {\n%s\n})",
+			group, ep.data.Method, strconv.Quote(ep.data.Path), handlerBody(ep, service))
+	}
+	if group != "" {
+		// Routes follow each other, the blank line stays before the return.
+		f.Insert(fn.Body.List[len(fn.Body.List)-2].End(), "\n"+route(group))
+	} else {
+		prefix, ok := routePrefix(pkg)
+		if !ok {
+			return fmt.Errorf("%s: NewRouter has no route group and the client no routePrefix", pkg.Dir)
+		}
+		group = "v1"
+		init := define(call(sel(goedit.Print(ret.Results[0]), "Group"), str(prefix)), group)
+		f.InsertLine(ret.Pos(), goedit.Print(init)+"\n"+route(group)+"\n\n")
+	}
+	for _, p := range []string{"net/http", imports.std, imports.api, "github.com/gin-gonic/gin"} {
+		f.AddImport(p)
+	}
+	return nil
+}
+
+// handlerBody returns the statements of a route handler: bind the request,
+// call the service and reply with the response.
+func handlerBody(ep endpoint, service string) string {
+	abort := func(status string) *ast.BlockStmt {
+		return block(
+			exprStmt(call(sel("c", "JSON"), sel("http", status), &ast.CompositeLit{
+				Type: sel("gin", "H"),
+				Elts: []ast.Expr{&ast.KeyValueExpr{Key: str("error"), Value: call(sel("err", "Error"))}},
+			})),
+			&ast.ReturnStmt{},
+		)
+	}
+	errCheck := &ast.IfStmt{Cond: notNil("err"), Body: abort("StatusInternalServerError")}
+
+	var groups [][]ast.Stmt
+	args := []ast.Expr{call(&ast.SelectorExpr{X: sel("c", "Request"), Sel: ident("Context")})}
+	if ep.op.Request != "" {
+		groups = append(groups, []ast.Stmt{
+			varDecl("req", sel("api", ep.op.Request)),
+			&ast.IfStmt{
+				Init: define(call(sel("std", "BindRequest"), ident("c"), &ast.UnaryExpr{Op: token.AND, X: ident("req")}), "err"),
+				Cond: notNil("err"),
+				Body: abort("StatusBadRequest"),
+			},
+		})
+		args = append(args, ident("req"))
+	}
+	serve := call(sel(service, ep.op.Name), args...)
+	if ep.op.Response != "" {
+		groups = append(groups,
+			[]ast.Stmt{define(serve, "resp", "err"), errCheck},
+			[]ast.Stmt{exprStmt(call(sel("c", "JSON"), sel("http", "StatusOK"), ident("resp")))},
+		)
+	} else {
+		groups = append(groups,
+			[]ast.Stmt{define(serve, "err"), errCheck},
+			[]ast.Stmt{exprStmt(call(sel("c", "Status"), sel("http", "StatusNoContent")))},
+		)
+	}
+	return printStmts(groups...)
+}
+
+// addClientMethod adds a method calling the endpoint to the api.Service
+// implementation of the client package, before its do helper.
+func addClientMethod(pkg *goedit.Package, ep endpoint, imports endpointImports) error {
+	typ, ok := pkg.Implementation("api.Service")
+	if !ok {
+		return fmt.Errorf("%s: no type asserted to implement api.Service", pkg.Dir)
+	}
+	if _, fn := pkg.Method(typ, ep.op.Name); fn != nil {
+		return fmt.Errorf("client.%s already has %s", typ, ep.op.Name)
+	}
+	f, do := pkg.Method(typ, "do")
+	if do == nil {
+		return fmt.Errorf("%s: client.%s has no do method, run mm update to regenerate the client", pkg.Dir, typ)
+	}
+	if len(ep.data.PathParams) > 0 {
+		if _, fn := pkg.Func("expandPath"); fn == nil {
+			return fmt.Errorf("%s: no expandPath function, run mm update to regenerate the client", pkg.Dir)
+		}
+	}
+	recv := do.Recv.List[0]
+
+	var route ast.Expr = str(ep.data.Path)
+	if len(ep.data.PathParams) > 0 {
+		route = call(ident("expandPath"), route, fieldMap(ep.data.PathParams))
+	}
+	var query ast.Expr = ident("nil")
+	if len(ep.data.Query) > 0 {
+		query = call(ident("queryValues"), fieldMap(ep.data.Query))
+	}
+	var body ast.Expr = ident("nil")
+	if ep.data.Body {
+		body = ident("req")
+	}
+	method := sel("http", "Method"+strings.Title(strings.ToLower(ep.data.Method)))
+	c := recv.Names[0].Name
+	stmts := []ast.Stmt{define(route, "path")}
+	if ep.op.Response != "" {
+		do := call(sel(c, "do"), ident("ctx"), method, ident("path"), query, body, &ast.UnaryExpr{Op: token.AND, X: ident("resp")})
+		stmts = append(stmts,
+			varDecl("resp", sel("api", ep.op.Response)),
+			&ast.IfStmt{
+				Init: define(do, "err"),
+				Cond: notNil("err"),
+				Body: block(&ast.ReturnStmt{Results: []ast.Expr{ident("nil"), ident("err")}}),
+			},
+			&ast.ReturnStmt{Results: []ast.Expr{&ast.UnaryExpr{Op: token.AND, X: ident("resp")}, ident("nil")}},
+		)
+	} else {
+		do := call(sel(c, "do"), ident("ctx"), method, ident("path"), query, body, ident("nil"))
+		stmts = append(stmts, &ast.ReturnStmt{Results: []ast.Expr{do}})
+	}
+	decl := &ast.FuncDecl{
+		Recv: &ast.FieldList{List: []*ast.Field{recv}},
+		Name: ident(ep.op.Name),
+		Type: signature(ep, "api"),
+		Body: block(stmts...),
+	}
+
+	pos := do.Pos()
+	if do.Doc != nil {
+		pos = do.Doc.Pos()
+	}
+	f.InsertLine(pos, goedit.Print(decl)+"\n\n")
+	for _, p := range []string{"context", "net/http", imports.api} {
+		f.AddImport(p)
+	}
+	return nil
+}
+
+// addCoreStub appends a method returning errNotImplemented to the api.Service
+// implementation of the core package. Its body is a keep-block, as in
+// generated code.
+func addCoreStub(pkg *goedit.Package, ep endpoint, imports endpointImports) error {
+	typ, ok := pkg.Implementation("api.Service")
+	if !ok {
+		return fmt.Errorf("%s: no type asserted to implement api.Service", pkg.Dir)
+	}
+	if _, fn := pkg.Method(typ, ep.op.Name); fn != nil {
+		return fmt.Errorf("core.%s already has %s", typ, ep.op.Name)
+	}
+
+	// The file asserting the implementation holds the generated methods.
+	var f *goedit.File
+	for _, file := range pkg.Files {
+		if bytes.Contains(file.Src, []byte("(*"+typ+")(nil)")) {
+			f = file
+		}
+	}
+	recv := &ast.Field{Names: []*ast.Ident{ident("s")}, Type: &ast.StarExpr{X: ident(typ)}}
+	for _, file := range pkg.Files {
+		for _, decl := range file.AST.Decls {
+			fn, ok := decl.(*ast.FuncDecl)
+			if ok && fn.Recv != nil && len(fn.Recv.List[0].Names) == 1 && goedit.Print(fn.Recv.List[0].Type) == "*"+typ {
+				recv = fn.Recv.List[0]
+			}
+		}
+	}
+
+	var notImplemented ast.Expr = ident("errNotImplemented")
+	if !pkg.Declares("errNotImplemented") {
+		notImplemented = call(sel("errors", "New"), str("not implemented"))
+		f.AddImport("errors")
+	}
+	ret := &ast.ReturnStmt{Results: []ast.Expr{notImplemented}}
+	if ep.op.Response != "" {
+		ret.Results = append([]ast.Expr{ident("nil")}, ret.Results...)
+	}
+	decl := &ast.FuncDecl{
+		Recv: &ast.FieldList{List: []*ast.Field{recv}},
+		Name: ident(ep.op.Name),
+		Type: signature(ep, "api"),
+	}
+	f.Append(fmt.Sprintf("%s {\n\t// mm:keep begin %s\n\t%s\n\t// mm:keep end\n}\n",
+		goedit.Print(decl), ep.op.Name, goedit.Print(ret)))
+	f.AddImport("context")
+	f.AddImport(imports.api)
+	return nil
+}
+
+// recordOperation adds the operation to the API definition of the service, if
+// it has one, and returns its path with the files rebaseGenerated wrote. The
+// operation is appended to api.toml as text to keep its comments where
+// possible. The manifest takes the new hash of api.toml, since mm wrote it.
+func recordOperation(t *lang.Txn, name string, cfg config.ServiceConfig, ep endpoint, defaults config.Defaults, edited []string) (string, []string, error) {
+	root := t.Root()
+	old, err := config.LoadAPI(root, name, cfg)
+	if err != nil || old == nil {
+		return "", nil, err
+	}
+	manifest, err := lang.LoadManifest(root)
+	if err != nil {
+		return "", nil, err
+	}
+	updated := config.APIConfig{
+		Operations: append(append([]config.Operation(nil), old.Operations...), ep.op),
+		Types:      append(append([]config.TypeDef(nil), old.Types...), ep.types...),
+	}
+	if err := updated.Validate(); err != nil {
+		return "", nil, fmt.Errorf("record %s in the API definition: %w", ep.op.Name, err)
+	}
+
+	var rel string
+	if cfg.API != nil {
+		rel = lang.ServiceConfigPath(name)
+		cfg.API = &updated
+		data, err := config.MarshalServiceConfig(cfg)
+		if err != nil {
+			return "", nil, err
+		}
+		if err := t.Write(rel, data); err != nil {
+			return "", nil, err
+		}
+	} else {
+		rel = path.Join("services", name, config.APIFile)
+		existing, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return "", nil, err
+		}
+		added := config.MarshalAPI(config.APIConfig{Operations: []config.Operation{ep.op}, Types: ep.types})
+		if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+			existing = append(existing, '\n')
+		}
+		content := append(append(existing, '\n'), added...)
+		// Appending fails when the file declares the arrays inline.
+		if _, err := config.ParseAPI(content); err != nil {
+			content = config.MarshalAPI(updated)
+		}
+		if err := t.Write(rel, content); err != nil {
+			return "", nil, err
+		}
+		manifest.Rehash(rel, content)
+	}
+	files, err := rebaseGenerated(t, manifest, name, cfg, *old, updated, defaults, edited)
+	if err != nil {
+		return "", nil, err
+	}
+	return rel, files, t.SaveManifest(manifest)
+}
+
+// rebaseGenerated merges the difference between rendering the old and the
+// updated API into the last generated content of the service, so that the
+// snapshots match what the pack now generates. Files that are not among the
+// edited ones, such as tests over every operation, take the difference too,
+// and files the pack only renders with the updated API are created; their
+// paths are returned. Files that would conflict are left to mm update. The
+// manifest is updated in place.
+func rebaseGenerated(t *lang.Txn, manifest *lang.Manifest, name string, cfg config.ServiceConfig, old, updated config.APIConfig, defaults config.Defaults, edited []string) ([]string, error) {
+	root := t.Root()
+	langName := cfg.General.Lang
+	if langName == "" {
+		langName = defaults.Lang
+	}
+	p, err := lang.FindByLang(root, langName)
+	if err != nil || p == nil {
+		return nil, err
+	}
+
+	vars := lang.NewTemplateData(root, name, cfg)
+	vars.API = lang.NewAPIData(old)
+	before, err := lang.Render(*p, vars)
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w", name, err)
+	}
+	vars.API = lang.NewAPIData(updated)
+	after, err := lang.Render(*p, vars)
+	if err != nil {
+		return nil, fmt.Errorf("render %s: %w", name, err)
+	}
+	previous := make(map[string][]byte, len(before))
+	for _, f := range before {
+		previous[f.Path] = f.Content
+	}
+
+	var written []string
+	for _, f := range after {
+		if f.Path == lang.ServiceConfigPath(name) {
+			continue
+		}
+		prev, ok := previous[f.Path]
+		if !ok {
+			if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(f.Path))); !errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err := t.Write(f.Path, f.Content); err != nil {
+				return nil, err
+			}
+			if err := t.SaveGenerated(f.Path, f.Content); err != nil {
+				return nil, err
+			}
+			manifest.Record(*p, vars, f)
+			written = append(written, f.Path)
+			continue
+		}
+		if bytes.Equal(prev, f.Content) {
+			continue
+		}
+		base, ok := lang.LoadGenerated(root, f.Path)
+		if !ok {
+			continue
+		}
+		merged := diff.Merge3(prev, base, f.Content, diff.DefaultMarkers)
+		if merged.Conflicts > 0 {
+			continue
+		}
+		merged.Content = lang.FormatGo(f.Path, merged.Content)
+		if !slices.Contains(edited, f.Path) {
+			current, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(f.Path)))
+			if err != nil {
+				continue
+			}
+			result := diff.Merge3(base, current, merged.Content, diff.DefaultMarkers)
+			if result.Conflicts > 0 {
+				continue
+			}
+			result.Content = lang.FormatGo(f.Path, result.Content)
+			if !bytes.Equal(result.Content, current) {
+				if err := t.Write(f.Path, result.Content); err != nil {
+					return nil, err
+				}
+				written = append(written, f.Path)
+			}
+		}
+		if err := t.SaveGenerated(f.Path, merged.Content); err != nil {
+			return nil, err
+		}
+		manifest.Rehash(f.Path, merged.Content)
+	}
+	return written, nil
+}
+
+// signature returns the method type of the operation, qualifying the API
+// types with pkg unless it is empty.
+func signature(ep endpoint, pkg string) *ast.FuncType {
+	qualify := func(name string) ast.Expr {
+		if pkg == "" {
+			return ident(name)
+		}
+		return sel(pkg, name)
+	}
+	params := []*ast.Field{{Names: []*ast.Ident{ident("ctx")}, Type: sel("context", "Context")}}
+	if ep.op.Request != "" {
+		params = append(params, &ast.Field{Names: []*ast.Ident{ident("req")}, Type: qualify(ep.op.Request)})
+	}
+	results := []*ast.Field{{Type: ident("error")}}
+	if ep.op.Response != "" {
+		results = append([]*ast.Field{{Type: &ast.StarExpr{X: qualify(ep.op.Response)}}}, results...)
+	}
+	return &ast.FuncType{Params: &ast.FieldList{List: params}, Results: &ast.FieldList{List: results}}
+}
+
+// routePrefix returns the prefix the client puts before every route.
+func routePrefix(server *goedit.Package) (string, bool) {
+	client, err := goedit.LoadPackage(filepath.Join(filepath.Dir(server.Dir), "client"))
+	if err != nil {
+		return "", false
+	}
+	return client.Const("routePrefix")
+}
+
+// fieldMap returns a map[string]any literal of request fields by JSON name.
+func fieldMap(fields []lang.FieldData) *ast.CompositeLit {
+	lit := &ast.CompositeLit{Type: &ast.MapType{Key: ident("string"), Value: ident("any")}}
+	for _, f := range fields {
+		lit.Elts = append(lit.Elts, &ast.KeyValueExpr{Key: str(f.JSON), Value: sel("req", f.Name)})
+	}
+	return lit
+}
+
+// printStmts prints groups of statements separated by blank lines.
+func printStmts(groups ...[]ast.Stmt) string {
+	var parts []string
+	for _, g := range groups {
+		var lines []string
+		for _, s := range g {
+			lines = append(lines, goedit.Print(s))
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// exportedName turns a path parameter such as order_id into a Go field name
+// such as OrderID.
+func exportedName(param string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(param, func(r rune) bool { return r == '_' || r == '-' }) {
+		switch upper := strings.ToUpper(part); upper {
+		case "ID", "URL", "URI", "UUID", "API", "HTTP", "SKU":
+			b.WriteString(upper)
+		default:
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	return b.String()
+}
+
+func ident(name string) *ast.Ident { return ast.NewIdent(name) }
+
+func sel(x, name string) *ast.SelectorExpr {
+	return &ast.SelectorExpr{X: ident(x), Sel: ident(name)}
+}
+
+func call(fun ast.Expr, args ...ast.Expr) *ast.CallExpr {
+	return &ast.CallExpr{Fun: fun, Args: args}
+}
+
+func str(s string) *ast.BasicLit {
+	return &ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(s)}
+}
+
+func define(rhs ast.Expr, names ...string) *ast.AssignStmt {
+	stmt := &ast.AssignStmt{Tok: token.DEFINE, Rhs: []ast.Expr{rhs}}
+	for _, name := range names {
+		stmt.Lhs = append(stmt.Lhs, ident(name))
+	}
+	return stmt
+}
+
+func notNil(name string) ast.Expr {
+	return &ast.BinaryExpr{X: ident(name), Op: token.NEQ, Y: ident("nil")}
+}
+
+func varDecl(name string, typ ast.Expr) ast.Stmt {
+	return &ast.DeclStmt{Decl: &ast.GenDecl{Tok: token.VAR, Specs: []ast.Spec{
+		&ast.ValueSpec{Names: []*ast.Ident{ident(name)}, Type: typ},
+	}}}
+}
+
+func exprStmt(x ast.Expr) ast.Stmt { return &ast.ExprStmt{X: x} }
+
+func block(stmts ...ast.Stmt) *ast.BlockStmt { return &ast.BlockStmt{List: stmts} }
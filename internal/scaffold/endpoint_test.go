@@ -0,0 +1,176 @@
+package scaffold
+
+import (
+	"bytes"
+	"context"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"micromanager/internal/config"
+)
+
+// newGoProject creates the project "shop" with the http service orders
+// rendered from the builtin Go pack, without running its hooks.
+func newGoProject(t *testing.T) (string, config.Defaults) {
+	t.Helper()
+	t.Setenv("MM_PACKS_DIR", t.TempDir())
+	root := t.TempDir()
+	defaults, err := InitRepo(context.Background(), root, InitOptions{Lang: "go"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, root, "go.mod", "module shop\n\ngo 1.21\n")
+	if _, err := NewService(context.Background(), root, "orders", NewServiceOptions{Defaults: defaults, SkipHooks: true}); err != nil {
+		t.Fatal(err)
+	}
+	return root, defaults
+}
+
+// snapshotTree returns the content of every file under root, .mm included.
+func snapshotTree(t *testing.T, root string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		rel, _ := filepath.Rel(root, p)
+		files[filepath.ToSlash(rel)] = string(data)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+// checkImportGroups checks that the import block of a Go file has the
+// standard library, third-party and project packages in that order, each
+// in its own group.
+func checkImportGroups(t *testing.T, name string, src []byte) {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name, src, parser.ImportsOnly)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kind := func(path string) int {
+		first, _, _ := strings.Cut(path, "/")
+		switch {
+		case path == "shop" || strings.HasPrefix(path, "shop/"):
+			return 2
+		case strings.Contains(first, "."):
+			return 1
+		}
+		return 0
+	}
+	var groups []int
+	prevLine := 0
+	for _, imp := range f.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		line := fset.Position(imp.Pos()).Line
+		k := kind(path)
+		switch {
+		case len(groups) == 0 || line > prevLine+1:
+			if len(groups) > 0 && groups[len(groups)-1] >= k {
+				t.Errorf("%s: import group of %s out of order", name, path)
+			}
+			groups = append(groups, k)
+		case groups[len(groups)-1] != k:
+			t.Errorf("%s: %s shares a group with imports of another kind", name, path)
+		}
+		prevLine = fset.Position(imp.End()).Line
+	}
+}
+
+func TestAddEndpoint(t *testing.T) {
+	root, defaults := newGoProject(t)
+	opts := AddEndpointOptions{Method: "POST", Path: "/orders/:id/cancel", Name: "CancelOrder", Defaults: defaults}
+	report, err := AddEndpoint(root, "orders", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.API != "services/orders/api.toml" {
+		t.Errorf("API = %q", report.API)
+	}
+	var edited []string
+	for _, rel := range report.Files {
+		if strings.HasSuffix(rel, ".go") {
+			edited = append(edited, rel)
+		}
+	}
+	for _, want := range []string{"services/orders/api/service.go", "services/orders/server/router.go", "services/orders/client/http.go"} {
+		if !strings.Contains(strings.Join(edited, " "), want) {
+			t.Errorf("%s not edited, files: %v", want, report.Files)
+		}
+	}
+
+	for rel, content := range snapshotTree(t, root) {
+		if !strings.HasSuffix(rel, ".go") || strings.HasPrefix(rel, ".mm/") {
+			continue
+		}
+		formatted, err := format.Source([]byte(content))
+		if err != nil {
+			t.Errorf("%s: %v", rel, err)
+			continue
+		}
+		if !bytes.Equal(formatted, []byte(content)) {
+			t.Errorf("%s is not gofmt-clean", rel)
+		}
+		checkImportGroups(t, rel, []byte(content))
+	}
+
+	api := readFile(t, root, "services/orders/api.toml")
+	for _, want := range []string{
+		"[[operations]]\nname = \"CancelOrder\"\nmethod = \"POST\"\npath = \"/orders/:id/cancel\"\n",
+		"[[types]]\nname = \"CancelOrderRequest\"\nfields = [\n  { name = \"ID\", type = \"string\" },\n]\n",
+	} {
+		if !strings.Contains(api, want) {
+			t.Errorf("api.toml lacks %q:\n%s", want, api)
+		}
+	}
+	if strings.Contains(api, "'") || strings.Contains(api, "[[types.fields]]") {
+		t.Errorf("api.toml changed style:\n%s", api)
+	}
+
+	t.Run("again", func(t *testing.T) {
+		before := snapshotTree(t, root)
+		if _, err := AddEndpoint(root, "orders", opts); err == nil || !strings.Contains(err.Error(), "CancelOrder") {
+			t.Fatalf("second AddEndpoint error = %v, want CancelOrder to exist", err)
+		}
+		if after := snapshotTree(t, root); !reflect.DeepEqual(after, before) {
+			for rel := range after {
+				if after[rel] != before[rel] {
+					t.Errorf("%s changed", rel)
+				}
+			}
+			t.Error("the tree changed")
+		}
+	})
+
+	t.Run("compiles", func(t *testing.T) {
+		if _, err := exec.LookPath("go"); err != nil {
+			t.Skip("go not installed")
+		}
+		tidy := exec.Command("go", "mod", "tidy")
+		tidy.Dir = root
+		if out, err := tidy.CombinedOutput(); err != nil {
+			t.Skipf("modules unavailable: %v\n%s", err, out)
+		}
+		vet := exec.Command("go", "vet", "./...")
+		vet.Dir = root
+		if out, err := vet.CombinedOutput(); err != nil {
+			t.Fatalf("go vet: %v\n%s", err, out)
+		}
+	})
+}
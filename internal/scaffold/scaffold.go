@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
@@ -20,7 +21,15 @@ type InitOptions struct {
 // NewServiceOptions configures service scaffolding.
 type NewServiceOptions struct {
 	Empty    bool
-	Defaults config.Defaults
+	Database string
+	// Type is the pack's service type; empty selects the pack's default.
+	Type string
+	// Values and Set supply pack variables, from a TOML file and from
+	// key=value flags respectively. Set takes precedence.
+	Values    map[string]any
+	Set       map[string]string
+	Defaults  config.Defaults
+	SkipHooks bool
 }
 
 // InitRepo creates .mm structure, services directory, build directory, and defaults.
@@ -53,13 +62,62 @@ func InitRepo(ctx context.Context, root string, opts InitOptions) (config.Defaul
 	return defaults, nil
 }
 
+// NewServiceReport describes a created service.
+type NewServiceReport struct {
+	Config config.ServiceConfig
+	// Orphans are keep-blocks of regenerated files that were not carried over.
+	Orphans []lang.OrphanBlock
+}
+
 // NewService scaffolds a service directory according to options and defaults.
-func NewService(root, name string, opts NewServiceOptions) (config.ServiceConfig, error) {
-	servicePath := filepath.Join(root, "services", name)
-	if err := os.MkdirAll(servicePath, 0o755); err != nil {
-		return config.ServiceConfig{}, err
+// All files are staged first and written together; when that or a hook
+// fails, the repository is restored, including common/ and service.toml.
+// Cancelling ctx stops the hooks.
+func NewService(ctx context.Context, root, name string, opts NewServiceOptions) (NewServiceReport, error) {
+	svcCfg, err := newServiceConfig(root, opts)
+	if err != nil {
+		return NewServiceReport{}, err
+	}
+
+	t, err := lang.BeginTxn(root)
+	if err != nil {
+		return NewServiceReport{}, err
 	}
+	defer t.Close()
 
+	data, err := config.MarshalServiceConfig(svcCfg)
+	if err != nil {
+		return NewServiceReport{}, err
+	}
+	if err := t.Write(lang.ServiceConfigPath(name), data); err != nil {
+		return NewServiceReport{}, err
+	}
+	p, orphans, err := stageServiceFiles(t, name, svcCfg, opts)
+	if err != nil {
+		return NewServiceReport{}, err
+	}
+
+	// Hooks typically rewrite files in the root, such as go.mod and go.sum.
+	t.ProtectFiles(".")
+	if err := t.Commit(); err != nil {
+		return NewServiceReport{}, err
+	}
+	if p != nil {
+		hooks := lang.HookOptions{Skip: opts.SkipHooks}
+		if err := lang.RunHooks(ctx, root, *p, []string{name}, hooks); err != nil {
+			return NewServiceReport{}, t.Abort(err)
+		}
+	}
+
+	if err := addDocInstruction(root, name); err != nil {
+		return NewServiceReport{}, err
+	}
+
+	return NewServiceReport{Config: svcCfg, Orphans: orphans}, nil
+}
+
+// newServiceConfig builds and validates the config of a new service.
+func newServiceConfig(root string, opts NewServiceOptions) (config.ServiceConfig, error) {
 	svcCfg := config.ServiceConfig{}
 
 	if opts.Empty {
@@ -68,64 +126,124 @@ func NewService(root, name string, opts NewServiceOptions) (config.ServiceConfig
 	} else {
 		svcCfg.General.Lang = opts.Defaults.Lang
 	}
+	svcCfg.General.Database = opts.Database
 
-	// Persist config before creating files, so downstream logic can read it if needed.
-	if err := config.SaveServiceConfig(root, name, svcCfg); err != nil {
-		return config.ServiceConfig{}, err
+	hasVars := len(opts.Values) > 0 || len(opts.Set) > 0
+	if opts.Empty && hasVars {
+		return config.ServiceConfig{}, fmt.Errorf("external services take no pack variables")
+	}
+	if opts.Empty && opts.Type != "" {
+		return config.ServiceConfig{}, fmt.Errorf("external services have no service type")
+	}
+	if !opts.Empty {
+		p, err := lang.FindByLang(root, svcCfg.General.Lang)
+		if err != nil {
+			return config.ServiceConfig{}, err
+		}
+		if p == nil && hasVars {
+			return config.ServiceConfig{}, fmt.Errorf("no pack found for lang %s to take variables", svcCfg.General.Lang)
+		}
+		if p == nil && opts.Type != "" {
+			return config.ServiceConfig{}, fmt.Errorf("no pack found for lang %s to provide service type %q", svcCfg.General.Lang, opts.Type)
+		}
+		if p != nil {
+			// The type is recorded even when defaulted, so the service
+			// keeps it should the pack change its default.
+			st, err := lang.FindServiceType(*p, opts.Type)
+			if err != nil {
+				return config.ServiceConfig{}, err
+			}
+			svcCfg.General.Type = st.Name
+		}
+		if p != nil && opts.Database != "" && !lang.SupportsDatabase(*p, opts.Database) {
+			return config.ServiceConfig{}, fmt.Errorf("pack %s does not support database %q (supported: %s)",
+				p.Meta.ID, opts.Database, strings.Join(lang.Databases(*p), ", "))
+		}
+		if hasVars {
+			vars, err := lang.CollectVars(*p, opts.Values, opts.Set)
+			if err != nil {
+				return config.ServiceConfig{}, err
+			}
+			svcCfg.Vars = vars
+		}
 	}
+	return svcCfg, nil
+}
 
-	if err := scaffoldServiceFiles(root, name, svcCfg, opts); err != nil {
-		return config.ServiceConfig{}, err
+// PlanNewService returns the files NewService would create or change without
+// writing anything.
+func PlanNewService(root, name string, opts NewServiceOptions) ([]lang.Change, error) {
+	svcCfg, err := newServiceConfig(root, opts)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := addDocInstruction(root, name); err != nil {
-		return config.ServiceConfig{}, err
+	if !opts.Empty {
+		p, err := lang.FindByLang(root, svcCfg.General.Lang)
+		if err != nil {
+			return nil, err
+		}
+		if p != nil {
+			return lang.PlanService(root, *p, name, svcCfg)
+		}
 	}
 
-	return svcCfg, nil
+	var changes []lang.Change
+	c, ok, err := lang.PlanServiceConfig(root, name, svcCfg, nil)
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		changes = append(changes, c)
+	}
+	files := map[string]string{
+		path.Join("services", name, "README.md"): serviceReadme(name),
+	}
+	if opts.Empty {
+		files[path.Join("services", name, "Dockerfile")] = defaultDockerfile(svcCfg.General.Lang)
+	}
+	for p, content := range files {
+		c, ok, err := lang.PlanFile(root, p, []byte(content))
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			changes = append(changes, c)
+		}
+	}
+	lang.SortChanges(changes)
+	return changes, nil
 }
 
-func scaffoldServiceFiles(root, name string, cfg config.ServiceConfig, opts NewServiceOptions) error {
-	servicePath := filepath.Join(root, "services", name)
+// stageServiceFiles stages the files of a new service and returns the pack
+// used, if any, with the keep-blocks it could not carry over.
+func stageServiceFiles(t *lang.Txn, name string, cfg config.ServiceConfig, opts NewServiceOptions) (*lang.Pack, []lang.OrphanBlock, error) {
+	servicePath := path.Join("services", name)
 
 	// Attempt to use a language pack for this service language if available
 	if !opts.Empty {
-		if p, err := lang.FindByLang(root, cfg.General.Lang); err != nil {
-			return err
+		if p, err := lang.FindByLang(t.Root(), cfg.General.Lang); err != nil {
+			return nil, nil, err
 		} else if p != nil {
-			if err := lang.ApplyService(root, *p, name); err != nil {
-				return err
-			}
-			// Pack applied successfully; do not run default scaffolding
-			return nil
+			orphans, err := lang.StageService(t, *p, name, cfg)
+			return p, orphans, err
 		}
 	}
 
 	if opts.Empty {
-		if err := writeFile(filepath.Join(servicePath, "Dockerfile"), defaultDockerfile(cfg.General.Lang)); err != nil {
-			return err
+		if err := t.Write(path.Join(servicePath, "Dockerfile"), []byte(defaultDockerfile(cfg.General.Lang))); err != nil {
+			return nil, nil, err
 		}
-		if err := writeFile(filepath.Join(servicePath, "README.md"), serviceReadme(name)); err != nil {
-			return err
-		}
-		return nil
 	}
 
-	// No pack found - service directory already created, just add README
-	return writeFile(filepath.Join(servicePath, "README.md"), serviceReadme(name))
+	// No pack found, or an external service: add a README
+	return nil, nil, t.Write(path.Join(servicePath, "README.md"), []byte(serviceReadme(name)))
 }
 
 func serviceReadme(name string) string {
 	return fmt.Sprintf("# %s\n\nService scaffold generated by mm.\n", name)
 }
 
-func writeFile(path, content string) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return err
-	}
-	return os.WriteFile(path, []byte(content), 0o644)
-}
-
 func defaultDockerfile(lang string) string {
 	return fmt.Sprintf("# Dockerfile for %s service\nFROM alpine\nCMD [\"echo\", \"stub\"]\n", lang)
 }
@@ -0,0 +1,37 @@
+package scaffold
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestNewServiceStopsHooksOnCancel(t *testing.T) {
+	root, defaults := newDemoProject(t, "# {{.ServiceName}}\n")
+	writeFile(t, root, ".mm/packs/demo/pack.toml", `id = "demo"
+lang = "demo"
+version = "0.1.0"
+
+[[hooks.post_generate]]
+name = "slow"
+command = ["sleep", "30"]
+optional = true
+`)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(200*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := NewService(ctx, root, "users", NewServiceOptions{Defaults: defaults})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("NewService error = %v, want canceled", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("hook ran for %s after cancel", elapsed)
+	}
+	if _, err := os.Stat(filepath.Join(root, "services", "users")); !os.IsNotExist(err) {
+		t.Errorf("services/users not rolled back: %v", err)
+	}
+}
@@ -0,0 +1,416 @@
+package scaffold
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"micromanager/internal/config"
+	"micromanager/internal/diff"
+	"micromanager/internal/lang"
+	"micromanager/internal/mocks"
+)
+
+// UpdateStatus describes what happened to a file during an update.
+type UpdateStatus string
+
+const (
+	StatusCreated   UpdateStatus = "created"
+	StatusUpdated   UpdateStatus = "updated"
+	StatusMerged    UpdateStatus = "merged"
+	StatusConflict  UpdateStatus = "conflict"
+	StatusUnchanged UpdateStatus = "unchanged"
+	StatusDeleted   UpdateStatus = "deleted"
+	StatusSkipped   UpdateStatus = "skipped"
+)
+
+// UpdateOptions configures service regeneration.
+type UpdateOptions struct {
+	Defaults config.Defaults
+	// DryRun computes the update without writing anything. The report then
+	// lists the content changes in Changes.
+	DryRun bool
+	// SkipHooks disables the post-generate hooks of the packs.
+	SkipHooks bool
+}
+
+// FileUpdate reports the outcome for a single file.
+type FileUpdate struct {
+	Path      string
+	Status    UpdateStatus
+	Conflicts int
+	Note      string
+	// Orphans are keep-blocks of the local file missing from the result.
+	Orphans []lang.OrphanBlock
+}
+
+// UpdateReport collects the outcome of an update run.
+type UpdateReport struct {
+	Files   []FileUpdate
+	Changes []lang.Change
+}
+
+// Conflicts returns the number of files left with conflict markers.
+func (r UpdateReport) Conflicts() int {
+	n := 0
+	for _, f := range r.Files {
+		if f.Status == StatusConflict {
+			n++
+		}
+	}
+	return n
+}
+
+// Orphans returns the keep-blocks that were not carried over.
+func (r UpdateReport) Orphans() []lang.OrphanBlock {
+	var orphans []lang.OrphanBlock
+	for _, f := range r.Files {
+		orphans = append(orphans, f.Orphans...)
+	}
+	return orphans
+}
+
+// Changed reports whether any file in the repository was modified.
+func (r UpdateReport) Changed() bool {
+	return filesChanged(r.Files)
+}
+
+func filesChanged(files []FileUpdate) bool {
+	for _, f := range files {
+		switch f.Status {
+		case StatusCreated, StatusUpdated, StatusMerged, StatusConflict, StatusDeleted:
+			return true
+		}
+	}
+	return false
+}
+
+// UpdateServices re-renders services from their packs and three-way merges the
+// result into the tree, using the last generated output as the common ancestor.
+// When names is empty, every service under services/ is updated. Changes are
+// staged and written together, and undone again when a hook fails. The mocks
+// of changed services are regenerated before the hooks run, which stop
+// when ctx is cancelled.
+func UpdateServices(ctx context.Context, root string, names []string, opts UpdateOptions) (UpdateReport, error) {
+	if len(names) == 0 {
+		all, err := config.ListServices(root)
+		if err != nil {
+			return UpdateReport{}, err
+		}
+		names = all
+	}
+
+	manifest, err := lang.LoadManifest(root)
+	if err != nil {
+		return UpdateReport{}, err
+	}
+
+	var t *lang.Txn
+	if !opts.DryRun {
+		if t, err = lang.BeginTxn(root); err != nil {
+			return UpdateReport{}, err
+		}
+		defer t.Close()
+	}
+
+	var report UpdateReport
+	seen := make(map[string]bool)
+	// Services whose files changed, grouped by pack for the hooks.
+	var packs []lang.Pack
+	changedServices := make(map[string][]string)
+	var mocked []string
+	for _, name := range names {
+		cfg, err := config.LoadServiceConfig(root, name)
+		if err != nil {
+			return report, fmt.Errorf("load %s config: %w", name, err)
+		}
+		if cfg.General.External {
+			continue
+		}
+		langName := cfg.General.Lang
+		if langName == "" {
+			langName = opts.Defaults.Lang
+		}
+		p, err := lang.FindByLang(root, langName)
+		if err != nil {
+			return report, err
+		}
+		if p == nil {
+			return report, fmt.Errorf("no pack found for %s (lang=%s)", name, langName)
+		}
+
+		vars, err := lang.LoadTemplateData(root, name, cfg)
+		if err != nil {
+			return report, err
+		}
+		files, err := lang.Render(*p, vars)
+		if err != nil {
+			return report, fmt.Errorf("render %s: %w", name, err)
+		}
+
+		first := len(report.Files)
+		rendered := make(map[string]bool)
+		for _, f := range files {
+			rendered[f.Path] = true
+			if seen[f.Path] {
+				continue
+			}
+			seen[f.Path] = true
+
+			if f.Path == lang.ServiceConfigPath(name) {
+				c, changed, err := lang.PlanServiceConfig(root, name, cfg, f.Content)
+				if err != nil {
+					return report, err
+				}
+				status := StatusUnchanged
+				if changed {
+					status = StatusUpdated
+					if opts.DryRun {
+						report.Changes = append(report.Changes, c)
+					} else if err := t.Write(c.Path, c.New); err != nil {
+						return report, err
+					}
+				}
+				report.Files = append(report.Files, FileUpdate{Path: f.Path, Status: status})
+				continue
+			}
+
+			res, content, err := mergeFile(root, f)
+			if err != nil {
+				return report, err
+			}
+			if content != nil {
+				if opts.DryRun {
+					c, _, err := lang.PlanFile(root, f.Path, content)
+					if err != nil {
+						return report, err
+					}
+					report.Changes = append(report.Changes, c)
+				} else if err := t.Write(f.Path, content); err != nil {
+					return report, err
+				}
+			}
+			if !opts.DryRun {
+				if err := t.SaveGenerated(f.Path, f.Content); err != nil {
+					return report, err
+				}
+			}
+			if res.Status != StatusSkipped {
+				recordMerged(root, manifest, *p, vars, f, res, content)
+			}
+			report.Files = append(report.Files, res)
+		}
+
+		for _, prefix := range []string{path.Join("services", name), "common"} {
+			removed, err := removeObsolete(root, t, prefix, rendered, seen)
+			if err != nil {
+				return report, err
+			}
+			for _, r := range removed {
+				manifest.Remove(r.Path)
+				if opts.DryRun && r.Status == StatusDeleted {
+					c, _, err := lang.PlanDelete(root, r.Path)
+					if err != nil {
+						return report, err
+					}
+					report.Changes = append(report.Changes, c)
+				}
+			}
+			report.Files = append(report.Files, removed...)
+		}
+		if !filesChanged(report.Files[first:]) {
+			continue
+		}
+		if _, ok := changedServices[p.Meta.ID]; !ok {
+			packs = append(packs, *p)
+		}
+		changedServices[p.Meta.ID] = append(changedServices[p.Meta.ID], name)
+		if mocks.Exists(root, name) {
+			mocked = append(mocked, name)
+		}
+	}
+
+	if opts.DryRun {
+		lang.SortChanges(report.Changes)
+		return report, nil
+	}
+
+	if err := t.SaveManifest(manifest); err != nil {
+		return report, err
+	}
+	// Hooks typically rewrite files in the root, such as go.mod and go.sum.
+	t.ProtectFiles(".")
+	for _, name := range mocked {
+		t.ProtectFiles(path.Dir(mocks.Path(name)))
+	}
+	if err := t.Commit(); err != nil {
+		return report, err
+	}
+
+	// Hooks would run against files still containing conflict markers.
+	if report.Conflicts() > 0 {
+		return report, nil
+	}
+	refreshed, err := refreshMocks(root, mocked)
+	if err != nil {
+		return report, t.Abort(err)
+	}
+	report.Files = append(report.Files, refreshed...)
+	for _, p := range packs {
+		hooks := lang.HookOptions{Skip: opts.SkipHooks}
+		if err := lang.RunHooks(ctx, root, p, changedServices[p.Meta.ID], hooks); err != nil {
+			return report, t.Abort(err)
+		}
+	}
+	return report, nil
+}
+
+// refreshMocks regenerates the mocks of services whose API may have changed.
+// Mocks only exist once mm mocks has created them.
+func refreshMocks(root string, names []string) ([]FileUpdate, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	results, err := mocks.Generate(root, names)
+	if err != nil {
+		return nil, fmt.Errorf("regenerate mocks: %w", err)
+	}
+	var files []FileUpdate
+	for _, r := range results {
+		status := StatusUnchanged
+		switch r.Status {
+		case mocks.StatusCreated:
+			status = StatusCreated
+		case mocks.StatusUpdated:
+			status = StatusUpdated
+		}
+		files = append(files, FileUpdate{Path: r.Path, Status: status})
+	}
+	return files, nil
+}
+
+// recordMerged records a merged file in the manifest. A file that mm edited
+// after generating it, such as api.toml after mm add endpoint, keeps the hash
+// of its merged content as long as nobody else touched it, so that it is not
+// reported as modified.
+func recordMerged(root string, manifest *lang.Manifest, p lang.Pack, vars lang.TemplateData, f lang.File, res FileUpdate, merged []byte) {
+	prev, ok := manifest.Lookup(f.Path)
+	manifest.Record(p, vars, f)
+	if !ok || prev.Hash == lang.HashContent(f.Content) || res.Conflicts > 0 {
+		return
+	}
+	ours, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(f.Path)))
+	if err != nil || lang.HashContent(ours) != prev.Hash {
+		return
+	}
+	if merged == nil {
+		merged = ours
+	}
+	manifest.Rehash(f.Path, merged)
+}
+
+// mergeFile merges a freshly rendered file with the local copy, carrying the
+// keep-blocks of the local copy over. It returns the content to write, or nil
+// when the local file stays as it is.
+func mergeFile(root string, f lang.File) (FileUpdate, []byte, error) {
+	res := FileUpdate{Path: f.Path}
+	target := filepath.Join(root, filepath.FromSlash(f.Path))
+	ours, err := os.ReadFile(target)
+	oursExists := err == nil
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return res, nil, err
+	}
+	base, hasBase := lang.LoadGenerated(root, f.Path)
+	theirs := f.Content
+	if oursExists {
+		if theirs, err = lang.ApplyKeepBlocks(f.Content, ours); err != nil {
+			return res, nil, fmt.Errorf("%s: %w", f.Path, err)
+		}
+	}
+
+	switch {
+	case !oursExists && hasBase:
+		// Deleted locally: respect that unless the pack changed the file.
+		res.Status = StatusSkipped
+		if !bytes.Equal(base, f.Content) {
+			res.Note = "deleted locally but changed in pack"
+		}
+	case !oursExists:
+		res.Status = StatusCreated
+		return res, f.Content, nil
+	case bytes.Equal(ours, theirs), hasBase && bytes.Equal(base, f.Content):
+		res.Status = StatusUnchanged
+	default:
+		if !hasBase {
+			base = diff.Common(ours, f.Content)
+		}
+		merged := diff.Merge3(base, ours, theirs, diff.DefaultMarkers)
+		if merged.Conflicts == 0 {
+			// Merged lines may need realigning, e.g. struct fields.
+			merged.Content = lang.FormatGo(f.Path, merged.Content)
+		}
+		res.Conflicts = merged.Conflicts
+		res.Orphans = lang.MissingKeepBlocks(f.Path, ours, merged.Content)
+		switch {
+		case merged.Conflicts > 0:
+			res.Status = StatusConflict
+		case bytes.Equal(ours, base):
+			res.Status = StatusUpdated
+		default:
+			res.Status = StatusMerged
+		}
+		return res, merged.Content, nil
+	}
+	return res, nil, nil
+}
+
+// removeObsolete stages the deletion of files that were generated under prefix
+// before but are no longer produced by the pack. Locally modified files are
+// kept. Without a transaction (a dry run) it only reports what would be deleted.
+func removeObsolete(root string, t *lang.Txn, prefix string, rendered, seen map[string]bool) ([]FileUpdate, error) {
+	dir := filepath.Join(lang.GeneratedDir(root), filepath.FromSlash(prefix))
+	if _, err := os.Stat(dir); err != nil {
+		return nil, nil
+	}
+
+	var results []FileUpdate
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(lang.GeneratedDir(root), p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rendered[rel] || seen[rel] || !strings.HasPrefix(rel, prefix+"/") {
+			return nil
+		}
+		base, _ := os.ReadFile(p)
+		target := filepath.Join(root, filepath.FromSlash(rel))
+		ours, err := os.ReadFile(target)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+		case err != nil:
+			return err
+		case bytes.Equal(ours, base):
+			if t != nil {
+				t.Remove(rel)
+			}
+			results = append(results, FileUpdate{Path: rel, Status: StatusDeleted})
+		default:
+			results = append(results, FileUpdate{Path: rel, Status: StatusSkipped, Note: "removed from pack but modified locally"})
+		}
+		if t != nil {
+			t.RemoveGenerated(rel)
+		}
+		return nil
+	})
+	return results, err
+}
@@ -0,0 +1,136 @@
+package scaffold
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"micromanager/internal/config"
+	"micromanager/internal/lang"
+)
+
+const notesPath = "services/orders/notes.md"
+
+// newDemoProject creates a project with the pack "demo" in .mm/packs and
+// the service orders generated from it.
+func newDemoProject(t *testing.T, notes string) (string, config.Defaults) {
+	t.Helper()
+	t.Setenv("MM_PACKS_DIR", t.TempDir())
+	root := t.TempDir()
+	defaults, err := InitRepo(context.Background(), root, InitOptions{Lang: "demo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, root, ".mm/packs/demo/pack.toml", "id = \"demo\"\nlang = \"demo\"\nversion = \"0.1.0\"\n")
+	writeFile(t, root, ".mm/packs/demo/templates/service/notes.md", notes)
+	if _, err := NewService(context.Background(), root, "orders", NewServiceOptions{Defaults: defaults}); err != nil {
+		t.Fatal(err)
+	}
+	return root, defaults
+}
+
+func writeFile(t *testing.T, root, rel, content string) {
+	t.Helper()
+	p := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, root, rel string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(rel)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// fileUpdate returns the report entry of a file.
+func fileUpdate(t *testing.T, report UpdateReport, rel string) FileUpdate {
+	t.Helper()
+	for _, f := range report.Files {
+		if f.Path == rel {
+			return f
+		}
+	}
+	t.Fatalf("%s not in the report %+v", rel, report.Files)
+	return FileUpdate{}
+}
+
+func TestUpdateMergesUserEditAndTemplateChange(t *testing.T) {
+	root, defaults := newDemoProject(t, "# {{.ServiceName}}\n\nintro\n\nbody\n\nfooter\n")
+	if got := readFile(t, root, notesPath); got != "# orders\n\nintro\n\nbody\n\nfooter\n" {
+		t.Fatalf("generated notes = %q", got)
+	}
+
+	writeFile(t, root, notesPath, "# orders\n\nintro, edited locally\n\nbody\n\nfooter\n")
+	writeFile(t, root, ".mm/packs/demo/templates/service/notes.md", "# {{.ServiceName}}\n\nintro\n\nbody\n\nfooter from the pack\n\nappendix\n")
+
+	report, err := UpdateServices(context.Background(), root, nil, UpdateOptions{Defaults: defaults, SkipHooks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := fileUpdate(t, report, notesPath); f.Status != StatusMerged || f.Conflicts != 0 {
+		t.Errorf("notes update = %+v, want merged", f)
+	}
+	want := "# orders\n\nintro, edited locally\n\nbody\n\nfooter from the pack\n\nappendix\n"
+	if got := readFile(t, root, notesPath); got != want {
+		t.Errorf("merged notes:\n%s\nwant:\n%s", got, want)
+	}
+	// The pack output is the ancestor of the next update.
+	base, ok := lang.LoadGenerated(root, notesPath)
+	if !ok || string(base) != "# orders\n\nintro\n\nbody\n\nfooter from the pack\n\nappendix\n" {
+		t.Errorf("generated snapshot = %q", base)
+	}
+
+	// Updating again from the same pack leaves the user edit alone.
+	report, err = UpdateServices(context.Background(), root, nil, UpdateOptions{Defaults: defaults, SkipHooks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Changed() {
+		t.Errorf("second update changed %+v", report.Files)
+	}
+}
+
+func TestUpdateReportsConflicts(t *testing.T) {
+	root, defaults := newDemoProject(t, "# {{.ServiceName}}\n\nbody\n")
+	writeFile(t, root, notesPath, "# orders\n\nbody, edited locally\n")
+	writeFile(t, root, ".mm/packs/demo/templates/service/notes.md", "# {{.ServiceName}}\n\nbody from the pack\n")
+
+	report, err := UpdateServices(context.Background(), root, nil, UpdateOptions{Defaults: defaults, SkipHooks: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := fileUpdate(t, report, notesPath); f.Status != StatusConflict || f.Conflicts != 1 {
+		t.Errorf("notes update = %+v, want one conflict", f)
+	}
+	got := readFile(t, root, notesPath)
+	for _, want := range []string{"<<<<<<< local\nbody, edited locally\n", "=======\nbody from the pack\n>>>>>>> pack\n"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("notes lack %q:\n%s", want, got)
+		}
+	}
+}
+
+func TestUpdateDryRunWritesNothing(t *testing.T) {
+	root, defaults := newDemoProject(t, "# {{.ServiceName}}\n")
+	writeFile(t, root, ".mm/packs/demo/templates/service/notes.md", "# {{.ServiceName}} v2\n")
+
+	report, err := UpdateServices(context.Background(), root, nil, UpdateOptions{Defaults: defaults, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f := fileUpdate(t, report, notesPath); f.Status != StatusUpdated {
+		t.Errorf("notes update = %+v, want updated", f)
+	}
+	if got := readFile(t, root, notesPath); got != "# orders\n" {
+		t.Errorf("dry run wrote %q", got)
+	}
+}
@@ -1,17 +1,279 @@
 package testing
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"micromanager/internal/config"
+	"micromanager/internal/lang"
 )
 
-// Run executes tests for a specific service path or all services.
-// Currently a stub that reports intent.
-func Run(ctx context.Context, root, target string) error {
-	_ = ctx
-	if target == "" {
-		target = "all"
+// Options configures a test run.
+type Options struct {
+	// Concurrency bounds how many services are tested at once. It defaults to
+	// the number of CPUs.
+	Concurrency int
+	// Defaults supply the language of services that do not declare one.
+	Defaults config.Defaults
+}
+
+// Result holds the outcome of testing one service.
+type Result struct {
+	Service  string
+	Passed   int
+	Failed   int
+	Skipped  int
+	Duration time.Duration
+	// SkipReason is set when the service was not tested at all.
+	SkipReason string
+	Err        error
+	Output     []byte
+}
+
+// OK reports whether the service passed or was skipped.
+func (r Result) OK() bool {
+	return r.Err == nil && r.Failed == 0
+}
+
+// Run executes tests for a specific service path or all services, prints a
+// summary table and returns an error if any service failed.
+func Run(ctx context.Context, root, target string, opts Options) error {
+	services, err := resolveTargets(root, target)
+	if err != nil {
+		return err
+	}
+	if len(services) == 0 {
+		fmt.Println("No services found under services/")
+		return nil
+	}
+
+	results := RunServices(ctx, root, services, opts)
+	for _, r := range results {
+		if !r.OK() && len(r.Output) > 0 {
+			fmt.Printf("--- %s\n%s", r.Service, r.Output)
+			if !bytes.HasSuffix(r.Output, []byte("\n")) {
+				fmt.Println()
+			}
+		}
+	}
+	printSummary(results)
+
+	failed := 0
+	for _, r := range results {
+		if !r.OK() {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d service(s) failed", failed, len(results))
 	}
-	fmt.Printf("[dry-run] would run tests for '%s' under %s\n", target, root)
 	return nil
 }
+
+// RunServices tests the given services in parallel and returns results in input order.
+func RunServices(ctx context.Context, root string, services []string, opts Options) []Result {
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.NumCPU()
+	}
+
+	results := make([]Result, len(services))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range services {
+		wg.Add(1)
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			results[i] = testService(ctx, root, name, opts)
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+func resolveTargets(root, target string) ([]string, error) {
+	if target == "" || target == "all" {
+		return config.ListServices(root)
+	}
+	abs := target
+	if !filepath.IsAbs(abs) {
+		abs = filepath.Join(root, target)
+	}
+	rel, err := filepath.Rel(filepath.Join(root, "services"), abs)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") || strings.Contains(filepath.ToSlash(rel), "/") {
+		return nil, fmt.Errorf("%s is not a service directory under services/", target)
+	}
+	if _, err := os.Stat(filepath.Join(abs, "service.toml")); err != nil {
+		return nil, fmt.Errorf("service %s not found: %w", rel, err)
+	}
+	return []string{rel}, nil
+}
+
+func testService(ctx context.Context, root, name string, opts Options) Result {
+	res := Result{Service: name}
+	cfg, err := config.LoadServiceConfig(root, name)
+	if err != nil {
+		res.Err = fmt.Errorf("load config: %w", err)
+		return res
+	}
+	if cfg.General.External {
+		res.SkipReason = "external"
+		return res
+	}
+
+	langName := cfg.General.Lang
+	if langName == "" {
+		langName = opts.Defaults.Lang
+	}
+	p, err := lang.FindByLang(root, langName)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	if p == nil {
+		res.Err = fmt.Errorf("no pack found for lang %s", langName)
+		return res
+	}
+	st, err := lang.FindServiceType(*p, cfg.General.Type)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	// A service type may test its own build targets.
+	test := p.Meta.Test
+	if len(st.Test.Command) > 0 {
+		test = st.Test
+	}
+	if len(test.Command) == 0 {
+		res.SkipReason = fmt.Sprintf("pack %s has no test command", p.Meta.ID)
+		return res
+	}
+
+	vars := lang.NewTemplateData(root, name, cfg)
+	vars.Type = st.Name
+	args := make([]string, 0, len(test.Command))
+	for _, arg := range test.Command {
+		rendered, err := lang.RenderString(arg, vars)
+		if err != nil {
+			res.Err = fmt.Errorf("render test command: %w", err)
+			return res
+		}
+		args = append(args, rendered)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = root
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	start := time.Now()
+	runErr := cmd.Run()
+	res.Duration = time.Since(start)
+
+	if test.Format == lang.TestFormatGoJSON {
+		parseGoTestJSON(&res, stdout.Bytes())
+	} else {
+		res.Output = stdout.Bytes()
+		if runErr == nil {
+			res.Passed = 1
+		}
+	}
+	res.Output = append(res.Output, stderr.Bytes()...)
+	if runErr != nil {
+		if res.Failed == 0 {
+			// The command failed without a failing test, e.g. a build error.
+			res.Failed = 1
+		}
+		res.Err = runErr
+	}
+	return res
+}
+
+// testEvent is a single line of `go test -json` output.
+type testEvent struct {
+	Action  string
+	Package string
+	Test    string
+	Output  string
+}
+
+// parseGoTestJSON counts test results and keeps the output of failed tests and packages.
+func parseGoTestJSON(res *Result, data []byte) {
+	outputs := make(map[string]*strings.Builder)
+	var failedKeys []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		var ev testEvent
+		if err := json.Unmarshal(line, &ev); err != nil {
+			// Not an event, e.g. build output printed before the tests ran.
+			res.Output = append(res.Output, line...)
+			res.Output = append(res.Output, '\n')
+			continue
+		}
+		key := ev.Package + "\x00" + ev.Test
+		switch ev.Action {
+		case "build-output":
+			res.Output = append(res.Output, ev.Output...)
+		case "output":
+			b, ok := outputs[key]
+			if !ok {
+				b = &strings.Builder{}
+				outputs[key] = b
+			}
+			b.WriteString(ev.Output)
+		case "pass":
+			if ev.Test != "" {
+				res.Passed++
+			}
+		case "skip":
+			if ev.Test != "" {
+				res.Skipped++
+			}
+		case "fail":
+			if ev.Test != "" {
+				res.Failed++
+			}
+			failedKeys = append(failedKeys, key)
+		}
+	}
+
+	sort.Strings(failedKeys)
+	for _, key := range failedKeys {
+		if b, ok := outputs[key]; ok {
+			res.Output = append(res.Output, b.String()...)
+		}
+	}
+}
+
+func printSummary(results []Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SERVICE\tPASS\tFAIL\tSKIP\tTIME\tSTATUS")
+	for _, r := range results {
+		status := "ok"
+		switch {
+		case r.SkipReason != "":
+			status = "skipped (" + r.SkipReason + ")"
+		case !r.OK():
+			status = "FAIL"
+		}
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%s\t%s\n", r.Service, r.Passed, r.Failed, r.Skipped, r.Duration.Round(time.Millisecond), status)
+	}
+	w.Flush()
+}
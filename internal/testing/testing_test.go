@@ -0,0 +1,84 @@
+package testing
+
+import "testing"
+
+// goTestStream is the output of `go test -json ./...` for a package that
+// does not build and a package with a passing, a failing and a skipped test,
+// without the timings.
+const goTestStream = `{"ImportPath":"shop/broken [shop/broken.test]","Action":"build-output","Output":"# shop/broken [shop/broken.test]\n"}
+{"ImportPath":"shop/broken [shop/broken.test]","Action":"build-output","Output":"broken/broken_test.go:5:28: undefined: undefined\n"}
+{"ImportPath":"shop/broken [shop/broken.test]","Action":"build-fail"}
+{"Action":"start","Package":"shop/broken"}
+{"Action":"output","Package":"shop/broken","Output":"FAIL\tshop/broken [build failed]\n"}
+{"Action":"fail","Package":"shop/broken","FailedBuild":"shop/broken [shop/broken.test]"}
+{"Action":"start","Package":"shop/ok"}
+{"Action":"run","Package":"shop/ok","Test":"TestPass"}
+{"Action":"output","Package":"shop/ok","Test":"TestPass","Output":"=== RUN   TestPass\n"}
+{"Action":"output","Package":"shop/ok","Test":"TestPass","Output":"--- PASS: TestPass (0.00s)\n"}
+{"Action":"pass","Package":"shop/ok","Test":"TestPass"}
+{"Action":"run","Package":"shop/ok","Test":"TestFail"}
+{"Action":"output","Package":"shop/ok","Test":"TestFail","Output":"=== RUN   TestFail\n"}
+{"Action":"output","Package":"shop/ok","Test":"TestFail","Output":"    ok_test.go:7: boom\n"}
+{"Action":"output","Package":"shop/ok","Test":"TestFail","Output":"--- FAIL: TestFail (0.00s)\n"}
+{"Action":"fail","Package":"shop/ok","Test":"TestFail"}
+{"Action":"run","Package":"shop/ok","Test":"TestSkip"}
+{"Action":"output","Package":"shop/ok","Test":"TestSkip","Output":"=== RUN   TestSkip\n"}
+{"Action":"output","Package":"shop/ok","Test":"TestSkip","Output":"    ok_test.go:9: needs docker\n"}
+{"Action":"output","Package":"shop/ok","Test":"TestSkip","Output":"--- SKIP: TestSkip (0.00s)\n"}
+{"Action":"skip","Package":"shop/ok","Test":"TestSkip"}
+{"Action":"output","Package":"shop/ok","Output":"FAIL\n"}
+{"Action":"output","Package":"shop/ok","Output":"FAIL\tshop/ok\t0.002s\n"}
+{"Action":"fail","Package":"shop/ok"}
+`
+
+func TestParseGoTestJSON(t *testing.T) {
+	tests := []struct {
+		name                    string
+		stream                  string
+		passed, failed, skipped int
+		output                  string
+	}{
+		{
+			name:    "build failure and test results",
+			stream:  goTestStream,
+			passed:  1,
+			failed:  1,
+			skipped: 1,
+			output: "# shop/broken [shop/broken.test]\n" +
+				"broken/broken_test.go:5:28: undefined: undefined\n" +
+				"FAIL\tshop/broken [build failed]\n" +
+				"FAIL\nFAIL\tshop/ok\t0.002s\n" +
+				"=== RUN   TestFail\n    ok_test.go:7: boom\n--- FAIL: TestFail (0.00s)\n",
+		},
+		{
+			name: "output of passing tests is dropped",
+			stream: `{"Action":"run","Package":"shop/ok","Test":"TestPass"}
+{"Action":"output","Package":"shop/ok","Test":"TestPass","Output":"=== RUN   TestPass\n"}
+{"Action":"pass","Package":"shop/ok","Test":"TestPass"}
+{"Action":"output","Package":"shop/ok","Output":"ok  \tshop/ok\t0.002s\n"}
+{"Action":"pass","Package":"shop/ok"}
+`,
+			passed: 1,
+		},
+		{
+			name: "lines that are not events",
+			stream: `go: downloading github.com/google/uuid v1.6.0
+{"Action":"skip","Package":"shop/empty"}
+`,
+			output: "go: downloading github.com/google/uuid v1.6.0\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var res Result
+			parseGoTestJSON(&res, []byte(tt.stream))
+			if res.Passed != tt.passed || res.Failed != tt.failed || res.Skipped != tt.skipped {
+				t.Errorf("passed, failed, skipped = %d, %d, %d, want %d, %d, %d",
+					res.Passed, res.Failed, res.Skipped, tt.passed, tt.failed, tt.skipped)
+			}
+			if string(res.Output) != tt.output {
+				t.Errorf("output:\n%q\nwant:\n%q", res.Output, tt.output)
+			}
+		})
+	}
+}
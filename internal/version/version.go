@@ -0,0 +1,109 @@
+package version
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is the mm release version.
+const Version = "0.1.0"
+
+// Compare compares two dotted versions numerically. A leading "v" and any
+// pre-release or build suffix are ignored. It returns -1, 0 or 1.
+func Compare(a, b string) (int, error) {
+	pa, err := parse(a)
+	if err != nil {
+		return 0, err
+	}
+	pb, err := parse(b)
+	if err != nil {
+		return 0, err
+	}
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		switch {
+		case x < y:
+			return -1, nil
+		case x > y:
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+// Satisfies reports whether v matches a constraint such as ">=1.2" or
+// ">=1.2, <2". Comma-separated terms must all match. An empty constraint
+// matches every version.
+func Satisfies(v, constraint string) (bool, error) {
+	for _, term := range strings.Split(constraint, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		op, want := splitOperator(term)
+		cmp, err := Compare(v, want)
+		if err != nil {
+			return false, err
+		}
+		var ok bool
+		switch op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "=", "==", "":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ValidConstraint checks the syntax of a constraint accepted by Satisfies.
+func ValidConstraint(constraint string) error {
+	_, err := Satisfies("0", constraint)
+	return err
+}
+
+func splitOperator(term string) (string, string) {
+	for _, op := range []string{">=", "<=", "==", "!=", ">", "<", "="} {
+		if strings.HasPrefix(term, op) {
+			return op, strings.TrimSpace(strings.TrimPrefix(term, op))
+		}
+	}
+	return "", term
+}
+
+func parse(v string) ([]int, error) {
+	s := strings.TrimPrefix(strings.TrimSpace(v), "v")
+	if i := strings.IndexAny(s, "-+"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "" {
+		return nil, fmt.Errorf("invalid version %q", v)
+	}
+	var parts []int
+	for _, field := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(field)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid version %q", v)
+		}
+		parts = append(parts, n)
+	}
+	return parts, nil
+}
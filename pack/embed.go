@@ -0,0 +1,9 @@
+// Package pack holds the built-in language packs compiled into mm.
+package pack
+
+import "embed"
+
+// Builtin contains lang/<id>/ for every built-in pack.
+//
+//go:embed all:lang
+var Builtin embed.FS
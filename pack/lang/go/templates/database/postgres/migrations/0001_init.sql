@@ -0,0 +1,2 @@
+-- Initial schema. Add new migrations as NNNN_description.sql files.
+SELECT 1;